@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminController は運用者向けのAPI（ルームの設定の確認・変更）
+type AdminController struct{}
+
+func NewAdminController() *AdminController {
+	setupClients()
+	return &AdminController{}
+}
+
+// AdminAuth は管理APIへのリクエストを ADMIN_API_TOKEN（Authorization: Bearer xxx）で認証するミドルウェア
+// ADMIN_API_TOKEN が設定されていない場合は、すべてのリクエストを拒否する
+func AdminAuth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := os.Getenv("ADMIN_API_TOKEN")
+			given, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"message": "認証に失敗しました",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// ListBlocks はルームのブロック（タグ・著者・タイトルの語）の一覧を返す
+func (ad *AdminController) ListBlocks(c echo.Context) error {
+	roomID := c.Param("room_id")
+	rows, err := fetchBlockRows(c.Request().Context(), "room_id=eq."+url.QueryEscape(roomID))
+	if err != nil {
+		log.Printf("ルーム %s のブロックの取得に失敗しました: %v", roomID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "ブロックの取得に失敗しました",
+		})
+	}
+	if rows == nil {
+		rows = []roomBlock{}
+	}
+	return c.JSON(http.StatusOK, rows)
+}
+
+// AddBlock はルームにブロックを追加する。リクエストの本文は {"kind": "tag", "value": "ポエム"}
+func (ad *AdminController) AddBlock(c echo.Context) error {
+	var req struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "リクエストの解析に失敗しました",
+		})
+	}
+
+	ctx := c.Request().Context()
+	block, err := newBlock(ctx, c.Param("room_id"), req.Kind, req.Value)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+	}
+	if err := addBlock(ctx, block); err != nil {
+		log.Printf("ルーム %s のブロックの追加に失敗しました: %v", block.RoomID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "ブロックの追加に失敗しました",
+		})
+	}
+	return c.JSON(http.StatusCreated, block)
+}
+
+// RemoveBlock はルームのブロックをIDで削除する
+func (ad *AdminController) RemoveBlock(c echo.Context) error {
+	roomID := c.Param("room_id")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "ブロックのIDが不正です",
+		})
+	}
+	if err := deleteRows(c.Request().Context(), fmt.Sprintf("room_block?room_id=eq.%s&id=eq.%d", url.QueryEscape(roomID), id)); err != nil {
+		log.Printf("ルーム %s のブロックの削除に失敗しました: %v", roomID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "ブロックの削除に失敗しました",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,63 +2,164 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
 	"qiita-search/models"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
-type ArticleController struct{}
+type ArticleController struct {
+	// 1ルームの配信処理にかけられる最大時間
+	roomTimeout time.Duration
+	// Qiitaの残りリクエスト数がこれを下回ったら、リセットを待つか残りのルームを後回しにする
+	quotaReserve int
+	// リセットまでの待機をこの時間までは許容する
+	ratePauseMax time.Duration
+	// 分野で記事が見つからない回数がこれに達したら、ルームに削除するか確認する
+	exhaustStrikes int
+	// 確認への返信がないまま、この時間が過ぎたら分野を削除する
+	exhaustTimeout time.Duration
+	// 配信処理の結果を知らせる管理者への通知先
+	adminNotifiers []notifier
+	// 1回の配信で送る記事数の上限
+	maxDigestSize int
+	// 週のまとめを送る曜日（日本時間）
+	weeklyWeekday time.Weekday
+	// 週のまとめに載せる記事数と、その候補に求める最低ストック数
+	weeklySize      int
+	weeklyMinStocks int
+	// 週のまとめで分野ごとに検索するページ数
+	weeklyPages int
+	// 人気上昇中の記事として、直近何日に投稿された記事から探すか
+	trendingDays int
+	// 伸びを計算する期間（この期間内で最も古い記録と比べる）
+	trendingWindow time.Duration
+	// 人気上昇中の記事の候補に求める最低ストック数
+	trendingMinStocks int
+	// 記事の記録のために検索するページ数
+	trendingPages int
+	// 記事の記録を残す期間
+	snapshotRetention time.Duration
+	// 配信を休む日（HOLIDAY_SKIP=false の場合はnil）
+	holidays models.Holidays
+}
 
 func NewArticleController() *ArticleController {
 	rand.Seed(time.Now().UnixNano())
-	return &ArticleController{}
+	setupClients()
+	return &ArticleController{
+		roomTimeout:       envDuration("ROOM_TIMEOUT", 2*time.Minute),
+		quotaReserve:      envInt("QIITA_QUOTA_RESERVE", 20),
+		ratePauseMax:      envDuration("QIITA_RATE_PAUSE_MAX", time.Minute),
+		exhaustStrikes:    max(envInt("FIELD_EXHAUST_STRIKES", 3), 1),
+		exhaustTimeout:    envDuration("FIELD_EXHAUST_TIMEOUT", 72*time.Hour),
+		adminNotifiers:    newAdminNotifiers(),
+		maxDigestSize:     max(envInt("DIGEST_MAX_SIZE", 5), 1),
+		weeklyWeekday:     parseWeekday(os.Getenv("WEEKLY_DIGEST_WEEKDAY")),
+		weeklySize:        max(envInt("WEEKLY_DIGEST_SIZE", 5), 1),
+		weeklyMinStocks:   envInt("WEEKLY_DIGEST_MIN_STOCKS", 10),
+		weeklyPages:       max(envInt("WEEKLY_DIGEST_PAGES", 2), 1),
+		trendingDays:      max(envInt("TRENDING_DAYS", 7), 1),
+		trendingWindow:    envDuration("TRENDING_WINDOW", 24*time.Hour),
+		trendingMinStocks: envInt("TRENDING_MIN_STOCKS", 3),
+		trendingPages:     max(envInt("TRENDING_SNAPSHOT_PAGES", 2), 1),
+		snapshotRetention: envDuration("TRENDING_SNAPSHOT_RETENTION", 14*24*time.Hour),
+		holidays:          newHolidays(),
+	}
 }
 
-func (ac *ArticleController) Index(c echo.Context) error {
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	supabaseKey := os.Getenv("SUPABASE_KEY")
-	chatworkToken := os.Getenv("CHATWORK_API_TOKEN")
-
-	userReq, err := http.NewRequest("GET", supabaseURL+"/rest/v1/user?select=room_id", nil)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "ユーザー情報の取得に失敗しました",
-		})
+// newHolidays は配信を休む日を返す。同梱の日本の祝日に HOLIDAY_EXTRA_DATES（例: "2026-12-29,2026-12-30"）を加える
+// HOLIDAY_SKIP=false の場合は祝日も配信する
+func newHolidays() models.Holidays {
+	if skip, err := strconv.ParseBool(os.Getenv("HOLIDAY_SKIP")); err == nil && !skip {
+		return nil
 	}
-	userReq.Header.Set("apikey", supabaseKey)
-	userReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-	userReq.Header.Set("Content-Type", "application/json")
+	return models.JapaneseHolidays(strings.Split(os.Getenv("HOLIDAY_EXTRA_DATES"), ","))
+}
 
-	userResp, err := http.DefaultClient.Do(userReq)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "ユーザー情報の取得に失敗しました",
-		})
-	}
-	defer userResp.Body.Close()
+// errNoNewArticle は配信できる未配信の記事が見つからなかったことを表す
+var errNoNewArticle = errors.New("未配信の記事が見つかりませんでした")
+
+// roomSettings は userテーブルの1行（配信先のルームと、その設定）
+type roomSettings struct {
+	RoomID         string `json:"room_id"`
+	SearchStrategy string `json:"search_strategy"`
+	DigestSize     int    `json:"digest_size"`
+	// 配信の頻度（daily / weekly / both）と、週のまとめを最後に送った日時
+	Cadence      string     `json:"cadence"`
+	WeeklySentAt *time.Time `json:"weekly_sent_at"`
+	// ダイレクトチャットの場合は、配信先のメンバーのアカウントID
+	AccountID string `json:"account_id"`
+	// 配信の解除（/leave）の確認を送った日時
+	LeaveRequestedAt *time.Time `json:"leave_requested_at"`
+	// 配信を一時停止する期限（/pause）
+	PausedUntil *time.Time `json:"paused_until"`
+	// ブロックしたタグ・著者（room_blockテーブルから読み込む）
+	blocks roomBlocks
+	// 次の配信のプレビュー（記事が見つからなかった回数などを記録しない）
+	preview bool
+	// 登録できる分野数の上限（未設定の場合はプランの上限）と、プラン
+	FieldLimit int    `json:"field_limit"`
+	Plan       string `json:"plan"`
+}
 
-	userBody, err := io.ReadAll(userResp.Body)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "ユーザー情報の取得に失敗しました",
+// deliveryResult は1ルームへの配信結果
+type deliveryResult struct {
+	RoomID   string             `json:"room_id"`
+	Kind     string             `json:"kind"` // daily（毎日の記事）または weekly（週のまとめ）
+	Articles []deliveredArticle `json:"articles,omitempty"`
+	Outcome  deliveryOutcome    `json:"outcome"`
+	Error    string             `json:"error,omitempty"`
+	// Geminiでの要約に失敗した記事の数（要約なしで配信した記事・配信を見送った記事を含む）
+	SummaryFailures int `json:"summary_failures,omitempty"`
+}
+
+// deliveredArticle は配信した1記事と、その記事を見つけた分野・探し方
+type deliveredArticle struct {
+	URL      string `json:"url"`
+	Field    string `json:"field,omitempty"`
+	Strategy string `json:"strategy"`
+}
+
+// deliveryRun は1回の配信処理の結果
+type deliveryRun struct {
+	Results  []deliveryResult        `json:"results"`
+	Outcomes map[deliveryOutcome]int `json:"outcomes"`
+	Deferred []string                `json:"deferred"`
+	Quota    qiitaQuota              `json:"qiita_quota"`
+	Cache    qiitaCacheStats         `json:"qiita_cache"`
+}
+
+func (ac *ArticleController) Index(c echo.Context) error {
+	// 呼び出し元（cronなど）が切断しても残りのルームの配信を続けるため、キャンセルだけを切り離す
+	ctx := context.WithoutCancel(c.Request().Context())
+
+	// 祝日・休業日は配信しない（週のまとめは次の配信で送る）
+	if name, ok := ac.holidays.Lookup(time.Now().In(jst)); ok {
+		log.Printf("%s のため配信をスキップします", name)
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message": fmt.Sprintf("%sのため配信をスキップしました", name),
 		})
 	}
 
-	var users []struct {
-		RoomID string `json:"room_id"`
-	}
-	if err := json.Unmarshal(userBody, &users); err != nil {
+	// 設定の列が未作成の環境でも動くよう、すべての列を取得する
+	var users []roomSettings
+	if err := getRows(ctx, "user?select=*", &users); err != nil {
+		log.Printf("ユーザー情報の取得に失敗しました: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "ユーザー情報の解析に失敗しました",
+			"message": "ユーザー情報の取得に失敗しました",
 		})
 	}
 
@@ -66,492 +167,273 @@ func (ac *ArticleController) Index(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]interface{}{"message": "登録されているユーザーがいません"})
 	}
 
-	fieldReq, err := http.NewRequest("GET", supabaseURL+"/rest/v1/field?select=room_id,field_name,priority", nil)
+	fields, err := fetchFields(ctx, "")
 	if err != nil {
+		log.Printf("分野情報の取得に失敗しました: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"message": "分野情報の取得に失敗しました",
 		})
 	}
-	fieldReq.Header.Set("apikey", supabaseKey)
-	fieldReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-	fieldReq.Header.Set("Content-Type", "application/json")
 
-	fieldResp, err := http.DefaultClient.Do(fieldReq)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "分野情報の取得に失敗しました",
-		})
+	// ルームIDごとに分野と優先度をマッピング
+	// フォローしているユーザー・organizationの新着記事は Poll で配信するため除く
+	roomFields := make(map[string][]fieldInfo)
+	for _, field := range fields {
+		if field.isFollow() {
+			continue
+		}
+		roomFields[field.RoomID] = append(roomFields[field.RoomID], field)
 	}
-	defer fieldResp.Body.Close()
 
-	fieldBody, err := io.ReadAll(fieldResp.Body)
+	// ルームでブロックしたタグ・著者の記事は配信しない
+	blocks, err := fetchBlocks(ctx, "")
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "分野情報の取得に失敗しました",
-		})
+		log.Printf("ブロックの取得に失敗しました: %v", err)
 	}
 
-	var fields []struct {
-		RoomID    string `json:"room_id"`
-		FieldName string `json:"field_name"`
-		Priority  int    `json:"priority"`
-	}
-	if err := json.Unmarshal(fieldBody, &fields); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "分野情報の解析に失敗しました",
-		})
-	}
+	run := deliveryRun{Outcomes: make(map[deliveryOutcome]int)}
+	startQuota, _ := qiitaRateLimiter.Quota()
+	startCache := qiitaCache.Stats()
 
-	// ルームIDごとに分野と優先度をマッピング
-	type FieldInfo struct {
-		Name     string
-		Priority int
-	}
-	roomFields := make(map[string][]FieldInfo)
-	for _, field := range fields {
-		roomFields[field.RoomID] = append(roomFields[field.RoomID], FieldInfo{
-			Name:     field.FieldName,
-			Priority: field.Priority,
-		})
-	}
-
-	for _, user := range users {
+	for i, user := range users {
 		if user.RoomID == "" {
 			continue
 		}
 
-		fieldInfos, hasFields := roomFields[user.RoomID]
-		var selectedField string
-		var apiURL string
-		var articles []models.Article
-
-		if hasFields && len(fieldInfos) > 0 {
-			// 優先度に基づく重み付け合計を計算
-			totalWeight := 0
-			for _, field := range fieldInfos {
-				totalWeight += field.Priority
-			}
+		// 一時停止中のルームには配信しない
+		if user.paused(time.Now()) {
+			run.Results = append(run.Results, deliveryResult{RoomID: user.RoomID, Kind: cadenceDaily, Outcome: outcomePaused})
+			run.Outcomes[outcomePaused]++
+			continue
+		}
 
-			// 重み付けランダム選択
-			randomNum := rand.Intn(totalWeight)
-			currentWeight := 0
-			for _, field := range fieldInfos {
-				currentWeight += field.Priority
-				if randomNum < currentWeight {
-					selectedField = field.Name
-					break
+		// Qiitaの残りリクエスト数が少ない場合は、リセットを待つか残りのルームを後回しにする
+		if !qiitaRateLimiter.waitForQuota(ac.quotaReserve, ac.ratePauseMax, ctx.Done()) {
+			for _, rest := range users[i:] {
+				if rest.RoomID != "" {
+					run.Deferred = append(run.Deferred, rest.RoomID)
 				}
 			}
-
-			foundNewArticle := false
-
-			for page := 1; page <= 4; page++ {
-				// 単語を分割
-				searchWords := strings.Fields(selectedField)
-
-				if len(searchWords) > 1 {
-					// 複数単語の場合（例：cursor rules）
-					// すべてのタグを含む記事を検索（AND検索）
-					tagQueries := make([]string, len(searchWords))
-					for i, word := range searchWords {
-						tagQueries[i] = fmt.Sprintf("tag:%s", url.QueryEscape(word))
-					}
-					apiURL = fmt.Sprintf("https://qiita.com/api/v2/items?per_page=30&page=%d&query=stocks:>=30+%s",
-						page,
-						strings.Join(tagQueries, "+")) // + はAND条件
-
-				} else {
-					// 単一単語の場合（既存の検索方法）
-					apiURL = fmt.Sprintf("https://qiita.com/api/v2/items?per_page=30&page=%d&query=stocks:>=30+tag:%s",
-						page,
-						url.QueryEscape(selectedField))
-				}
-
-				articles, err = ac.searchArticles(apiURL)
-				if err != nil {
-					continue
-				}
-
-				if len(articles) == 0 {
-					break
-				}
-
-				// 履歴チェックと記事の保存
-				for _, article := range articles {
-					historyReq, err := http.NewRequest("GET",
-						fmt.Sprintf("%s/rest/v1/article_history?article_url=eq.%s&room_id=eq.%s",
-							supabaseURL,
-							url.QueryEscape(article.URL),
-							url.QueryEscape(user.RoomID)),
-						nil)
-					if err != nil {
-						continue
-					}
-
-					historyReq.Header.Set("apikey", supabaseKey)
-					historyReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-					historyReq.Header.Set("Content-Type", "application/json")
-
-					historyResp, err := http.DefaultClient.Do(historyReq)
-					if err != nil {
-						continue
-					}
-					defer historyResp.Body.Close()
-
-					var history []struct{}
-					if err := json.NewDecoder(historyResp.Body).Decode(&history); err != nil {
-						continue
-					}
-
-					if len(history) == 0 {
-						foundNewArticle = true
-						articles = []models.Article{article}
-						break
-					}
-				}
-
-				if foundNewArticle {
-					break
-				}
+			log.Printf("Qiita APIの残りリクエスト数が不足しているため、%d ルームの配信を後回しにします", len(run.Deferred))
+			break
+		}
+
+		user.blocks = blocks[user.RoomID]
+
+		// 1ルームの処理が止まっても他のルームに影響しないよう、ルームごとに期限を設ける
+		roomCtx, cancel := context.WithTimeout(ctx, ac.roomTimeout)
+		activeFields := ac.expireExhaustedFields(roomCtx, user.RoomID, roomFields[user.RoomID])
+		var results []deliveryResult
+		var errs []error
+		if user.wantsDaily() {
+			result, err := ac.deliverToRoom(roomCtx, user, activeFields)
+			result.Kind = cadenceDaily
+			results, errs = append(results, result), append(errs, err)
+		}
+		cancel()
+		if user.weeklyDue(time.Now(), ac.weeklyWeekday) {
+			// 週のまとめは検索する分野が多いため、毎日の配信とは別に期限を設ける
+			roomCtx, cancel := context.WithTimeout(ctx, ac.roomTimeout)
+			result, err := ac.deliverWeeklyRoundup(roomCtx, user, activeFields)
+			cancel()
+			results, errs = append(results, result), append(errs, err)
+		}
+
+		for j, result := range results {
+			err := errs[j]
+			result.Outcome = classifyOutcome(err)
+			if err != nil {
+				result.Error = err.Error()
 			}
-
-			if !foundNewArticle {
-				for page := 1; page <= 4; page++ {
-					// 単語を分割
-					searchWords := strings.Fields(selectedField)
-					var apiURL string
-					if len(searchWords) > 1 {
-						titleQueries := make([]string, len(searchWords))
-						for i, word := range searchWords {
-							titleQueries[i] = fmt.Sprintf("title:%s", url.QueryEscape(word))
-						}
-						apiURL = fmt.Sprintf("https://qiita.com/api/v2/items?per_page=30&page=%d&query=stocks:>=30+%s",
-							page,
-							strings.Join(titleQueries, "+"))
-					} else {
-						apiURL = fmt.Sprintf("https://qiita.com/api/v2/items?per_page=30&page=%d&query=stocks:>=30+title:%s",
-							page,
-							url.QueryEscape(selectedField))
-					}
-					articles, err = ac.searchArticles(apiURL)
-					if err != nil {
-						continue
-					}
-
-					if len(articles) == 0 {
-						break
-					}
-
-					for _, article := range articles {
-						historyReq, err := http.NewRequest("GET",
-							fmt.Sprintf("%s/rest/v1/article_history?article_url=eq.%s&room_id=eq.%s",
-								supabaseURL,
-								url.QueryEscape(article.URL),
-								url.QueryEscape(user.RoomID)),
-							nil)
-						if err != nil {
-							continue
-						}
-
-						historyReq.Header.Set("apikey", supabaseKey)
-						historyReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-						historyReq.Header.Set("Content-Type", "application/json")
-
-						historyResp, err := http.DefaultClient.Do(historyReq)
-						if err != nil {
-							continue
-						}
-						defer historyResp.Body.Close()
-
-						var history []struct{}
-						if err := json.NewDecoder(historyResp.Body).Decode(&history); err != nil {
-							continue
-						}
-
-						if len(history) == 0 {
-							foundNewArticle = true
-							articles = []models.Article{article}
-							break
-						}
-					}
-
-					if foundNewArticle {
-						break
-					}
-				}
+			if result.Outcome.isFailure() {
+				log.Printf("ルーム %s への配信（%s）に失敗しました（%s）: %v", user.RoomID, result.Kind, result.Outcome, err)
 			}
+			run.Results = append(run.Results, result)
+			run.Outcomes[result.Outcome]++
+		}
+	}
 
-			if !foundNewArticle {
-				deleteReq, err := http.NewRequest("DELETE",
-					fmt.Sprintf("%s/rest/v1/field?room_id=eq.%s&field_name=eq.%s",
-						supabaseURL,
-						url.QueryEscape(user.RoomID),
-						url.QueryEscape(selectedField)),
-					nil)
-				if err != nil {
-					continue
-				}
-
-				deleteReq.Header.Set("apikey", supabaseKey)
-				deleteReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-
-				deleteResp, err := http.DefaultClient.Do(deleteReq)
-				if err != nil {
-					continue
-				}
-				defer deleteResp.Body.Close()
-
-				// 削除通知を送信
-				messageText := fmt.Sprintf("・%s の人気の記事が見つかりませんでした。%s を削除します", selectedField, selectedField)
-				chatworkReq, err := http.NewRequest("POST",
-					fmt.Sprintf("https://api.chatwork.com/v2/rooms/%s/messages", user.RoomID),
-					strings.NewReader(fmt.Sprintf("body=%s", messageText)))
-				if err != nil {
-					continue
-				}
-
-				chatworkReq.Header.Set("X-ChatWorkToken", chatworkToken)
-				chatworkReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-				_, err = http.DefaultClient.Do(chatworkReq)
-				if err != nil {
-					continue
-				}
-
-				hasFields = false
-
-				foundNewArticle := false
-				for page := 1; page <= 4; page++ {
-					apiURL = fmt.Sprintf("https://qiita.com/api/v2/items?per_page=30&page=%d&query=stocks:>=30", page)
-					articles, err = ac.searchArticles(apiURL)
-					if err != nil {
-						continue
-					}
-
-					if len(articles) == 0 {
-						break
-					}
-
-					for _, article := range articles {
-						historyReq, err := http.NewRequest("GET",
-							fmt.Sprintf("%s/rest/v1/article_history?article_url=eq.%s&room_id=eq.%s",
-								supabaseURL,
-								url.QueryEscape(article.URL),
-								url.QueryEscape(user.RoomID)),
-							nil)
-						if err != nil {
-							continue
-						}
-
-						historyReq.Header.Set("apikey", supabaseKey)
-						historyReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-						historyReq.Header.Set("Content-Type", "application/json")
-
-						historyResp, err := http.DefaultClient.Do(historyReq)
-						if err != nil {
-							continue
-						}
-						defer historyResp.Body.Close()
-
-						var history []struct{}
-						if err := json.NewDecoder(historyResp.Body).Decode(&history); err != nil {
-							continue
-						}
-
-						if len(history) == 0 {
-							foundNewArticle = true
-							articles = []models.Article{article}
-							break
-						}
-					}
-
-					if foundNewArticle {
-						break
-					}
-				}
-
-				if !foundNewArticle {
-					continue
-				}
-			}
-		} else {
-			foundNewArticle := false
-			for page := 1; page <= 4; page++ {
-				apiURL = fmt.Sprintf("https://qiita.com/api/v2/items?per_page=30&page=%d&query=stocks:>=30", page)
-				articles, err = ac.searchArticles(apiURL)
-				if err != nil {
-					continue
-				}
+	run.Quota, _ = qiitaRateLimiter.Quota()
+	run.Quota.Requests -= startQuota.Requests
+	run.Cache = qiitaCache.Stats()
+	run.Cache.Hits -= startCache.Hits
+	run.Cache.Revalidated -= startCache.Revalidated
+	run.Cache.Misses -= startCache.Misses
 
-				if len(articles) == 0 {
-					break
-				}
+	ac.reportRun(ctx, run)
 
-				for _, article := range articles {
-					historyReq, err := http.NewRequest("GET",
-						fmt.Sprintf("%s/rest/v1/article_history?article_url=eq.%s&room_id=eq.%s",
-							supabaseURL,
-							url.QueryEscape(article.URL),
-							url.QueryEscape(user.RoomID)),
-						nil)
-					if err != nil {
-						continue
-					}
-
-					historyReq.Header.Set("apikey", supabaseKey)
-					historyReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-					historyReq.Header.Set("Content-Type", "application/json")
-
-					historyResp, err := http.DefaultClient.Do(historyReq)
-					if err != nil {
-						continue
-					}
-					defer historyResp.Body.Close()
-
-					var history []struct{}
-					if err := json.NewDecoder(historyResp.Body).Decode(&history); err != nil {
-						continue
-					}
-
-					if len(history) == 0 {
-						foundNewArticle = true
-						articles = []models.Article{article}
-						break
-					}
-				}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "処理が完了しました",
+		"result":  run,
+	})
+}
 
-				if foundNewArticle {
-					break
-				}
-			}
+// exhaustField は分野で記事が見つからなかったことを記録する
+// 連続で見つからなかった回数が上限に達したら、削除するか条件を緩めるかをルームに確認する
+func (ac *ArticleController) exhaustField(ctx context.Context, field fieldInfo) error {
+	strikes := field.EmptyStrikes + 1
+	values := map[string]interface{}{"empty_strikes": strikes}
+	exhausted := strikes >= ac.exhaustStrikes
+	if exhausted {
+		values["exhausted_at"] = time.Now().UTC()
+	}
+	if err := updateField(ctx, field, values); err != nil {
+		return err
+	}
+	if !exhausted {
+		return nil
+	}
 
-			if !foundNewArticle {
-				continue
-			}
-		}
+	messageText := fmt.Sprintf("%s[info][title]「%s」の記事が見つかりません[/title]"+
+		"「%s」の人気の記事が%d回続けて見つかりませんでした。どうするか返信してください。\n"+
+		"・削除する: /remove %s\n"+
+		"・ストック数の条件を緩める（現在 %d 以上）: /broaden %s\n"+
+		"・このまま残す: /keep %s\n"+
+		"%s以内に返信がない場合は削除します。[/info]",
+		mention(field.AccountID), field.Name, field.Name, strikes,
+		field.Name,
+		field.minStocks(), field.Name,
+		field.Name,
+		formatDuration(ac.exhaustTimeout))
+	_, err := postChatworkMessage(ctx, field.RoomID, messageText)
+	return err
+}
 
-		if len(articles) == 0 {
+// expireExhaustedFields は削除の確認中の分野を配信の対象から外し、
+// 確認から一定時間が過ぎた分野を削除してルームに通知する。配信の対象になる分野を返す
+func (ac *ArticleController) expireExhaustedFields(ctx context.Context, roomID string, fields []fieldInfo) []fieldInfo {
+	var active []fieldInfo
+	for _, field := range fields {
+		if field.ExhaustedAt == nil {
+			active = append(active, field)
 			continue
 		}
-
-		if err := articles[0].Summarize(); err != nil {
+		if time.Since(*field.ExhaustedAt) < ac.exhaustTimeout {
 			continue
 		}
 
-		tags := make([]string, len(articles[0].Tags))
-		for i, tag := range articles[0].Tags {
-			tags[i] = tag.Name
-		}
-		tagMessage := ""
-		if len(tags) > 0 {
-			tagMessage = "\nタグ: " + strings.Join(tags, ", ")
-		}
-
-		message := "本日の記事"
-		if hasFields && len(fieldInfos) > 0 {
-			message = fmt.Sprintf("「%s」の記事", selectedField)
-		}
-
-		// 最初のメッセージを送信
-		initialMessage := fmt.Sprintf("[info][title]%s[/title]%s\n%s\n\n%s%s[/info]",
-			message,
-			articles[0].Title,
-			articles[0].URL,
-			articles[0].Summary,
-			tagMessage)
-
-		formData := url.Values{}
-		formData.Set("body", initialMessage)
-
-		chatworkURL := fmt.Sprintf("https://api.chatwork.com/v2/rooms/%s/messages", user.RoomID)
-
-		chatworkReq, err := http.NewRequest("POST", chatworkURL, strings.NewReader(formData.Encode()))
-		if err != nil {
+		if err := deleteField(ctx, field); err != nil {
+			log.Printf("分野 %s の削除に失敗しました: %v", field.Name, err)
 			continue
 		}
-		chatworkReq.Header.Set("X-ChatWorkToken", chatworkToken)
-		chatworkReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-		chatworkResp, err := http.DefaultClient.Do(chatworkReq)
-		if err != nil {
-			continue
+		messageText := fmt.Sprintf("%s・%s の人気の記事が見つからず、返信もなかったため %s を削除しました", mention(field.AccountID), field.Name, field.Name)
+		if _, err := postChatworkMessage(ctx, roomID, messageText); err != nil {
+			log.Printf("ルーム %s への削除通知に失敗しました: %v", roomID, err)
 		}
-		defer chatworkResp.Body.Close()
+	}
+	return active
+}
 
-		// レスポンスからメッセージIDを取得
-		var messageResponse struct {
-			MessageID string `json:"message_id"`
-		}
-		if err := json.NewDecoder(chatworkResp.Body).Decode(&messageResponse); err != nil {
-			continue
-		}
+// formatDuration は期間を「3日」「12時間」のように表す
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d日", d/(24*time.Hour))
+	}
+	if d >= time.Hour {
+		return fmt.Sprintf("%d時間", d/time.Hour)
+	}
+	return fmt.Sprintf("%d分", d/time.Minute)
+}
 
-		// 保存リンクを含むメッセージを送信
-		baseURL := os.Getenv("BASE_URL")
-		if baseURL == "" {
-			baseURL = "http://localhost:8082" // デフォルト値
-		}
-		saveLinkMessage := fmt.Sprintf("[info]保存する場合は以下のリンクをクリック！！\n%s/save?room_id=%s&message_id=%s\nアプリはこちら！\nhttps://techapp-h845.onrender.com[/info]",
-			baseURL,
-			url.QueryEscape(user.RoomID),
-			url.QueryEscape(messageResponse.MessageID))
+// parseStoredField は保存済みの分野名を式として解析する
+// 解析できない古い分野名は、単語ごとのAND検索として扱う
+func parseStoredField(ctx context.Context, field string) *models.FieldExpr {
+	expr, err := models.ParseFieldExpr(field)
+	if err != nil {
+		expr, _ = models.ParseFieldExpr(strings.NewReplacer(`"`, " ", "-", " ").Replace(field))
+	}
+	if expr == nil {
+		expr = &models.FieldExpr{Clauses: []models.FieldClause{{Terms: []models.FieldTerm{{Value: field, Phrase: true}}}}}
+	}
+	qiitaTags.resolveExpr(ctx, expr)
+	return expr
+}
 
-		formData = url.Values{}
-		formData.Set("body", saveLinkMessage)
+// qiitaSearchURL はQiitaの記事検索APIのURLを組み立てる
+func qiitaSearchURL(page int, query string) string {
+	return fmt.Sprintf("https://qiita.com/api/v2/items?per_page=30&page=%d&query=%s", page, url.QueryEscape(query))
+}
 
-		chatworkReq, err = http.NewRequest("POST", chatworkURL, strings.NewReader(formData.Encode()))
-		if err != nil {
-			continue
+// findNewArticle は最大pagesページまで検索し、ルームにまだ配信していない記事を探す
+// 検索や履歴の確認に失敗したまま見つからなかった場合は、記事がないとは判断せずにエラーを返す
+// skipがtrueを返す記事（同じ配信ですでに選んだ記事、ブロックしたタグ・著者の記事）は選ばない
+func (ac *ArticleController) findNewArticle(ctx context.Context, roomID string, pages int, skip func(models.Article) bool, pageURL func(page int) string) (models.Article, bool, error) {
+	var lastErr error
+	for page := 1; page <= pages; page++ {
+		if ctx.Err() != nil {
+			return models.Article{}, false, withOutcome(outcomeUpstreamError, ctx.Err())
 		}
-		chatworkReq.Header.Set("X-ChatWorkToken", chatworkToken)
-		chatworkReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-		chatworkResp, err = http.DefaultClient.Do(chatworkReq)
+		articles, err := ac.searchArticles(ctx, pageURL(page))
+		if errors.Is(err, errQiitaRateLimited) {
+			// 続けて検索してもリクエスト数を消費するだけなので打ち切る
+			return models.Article{}, false, err
+		}
 		if err != nil {
+			log.Printf("記事の検索に失敗しました（%d ページ目）: %v", page, err)
+			lastErr = err
 			continue
 		}
-		defer chatworkResp.Body.Close()
 
-		historyData := map[string]interface{}{
-			"article_url": articles[0].URL,
-			"room_id":     user.RoomID,
-		}
-		historyJSON, err := json.Marshal(historyData)
-		if err != nil {
-			continue
+		if len(articles) == 0 {
+			break
 		}
 
-		historyPostReq, err := http.NewRequest("POST",
-			supabaseURL+"/rest/v1/article_history",
-			strings.NewReader(string(historyJSON)))
-		if err != nil {
-			continue
+		// 履歴チェック
+		for _, article := range articles {
+			if skip(article) {
+				continue
+			}
+			delivered, err := isDelivered(ctx, roomID, article.URL)
+			if err != nil {
+				log.Printf("配信履歴の確認に失敗しました: %v", err)
+				lastErr = err
+				continue
+			}
+			if !delivered {
+				return article, true, nil
+			}
 		}
+	}
+	if lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	return models.Article{}, false, withOutcome(outcomeUpstreamError, lastErr)
+}
 
-		historyPostReq.Header.Set("apikey", supabaseKey)
-		historyPostReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-		historyPostReq.Header.Set("Content-Type", "application/json")
+// isDelivered は記事がすでにルームへ配信済みかどうかを返す
+func isDelivered(ctx context.Context, roomID, articleURL string) (bool, error) {
+	historyReq, err := newSupabaseRequest(ctx, "GET",
+		fmt.Sprintf("article_history?article_url=eq.%s&room_id=eq.%s",
+			url.QueryEscape(articleURL),
+			url.QueryEscape(roomID)),
+		nil)
+	if err != nil {
+		return false, err
+	}
 
-		historyPostResp, err := http.DefaultClient.Do(historyPostReq)
-		if err != nil {
-			continue
-		}
-		defer historyPostResp.Body.Close()
+	historyResp, err := supabaseClient.Do(historyReq)
+	if err != nil {
+		return false, err
 	}
+	defer historyResp.Body.Close()
 
-	return c.String(http.StatusOK, "処理が完了しました")
+	var history []struct{}
+	if err := json.NewDecoder(historyResp.Body).Decode(&history); err != nil {
+		return false, err
+	}
+	return len(history) > 0, nil
 }
 
 // 記事検索用のヘルパー関数
-func (ac *ArticleController) searchArticles(apiURL string) ([]models.Article, error) {
+func (ac *ArticleController) searchArticles(ctx context.Context, apiURL string) ([]models.Article, error) {
 	if apiURL == "" {
 		return nil, fmt.Errorf("API URLが指定されていません")
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("リクエストの作成に失敗しました: %v", err)
+		return nil, fmt.Errorf("リクエストの作成に失敗しました: %w", err)
 	}
 
 	// Qiitaのアクセストークンを設定
@@ -560,17 +442,20 @@ func (ac *ArticleController) searchArticles(apiURL string) ([]models.Article, er
 		return nil, fmt.Errorf("QIITA_ACCESS_TOKENが設定されていません")
 	}
 	req.Header.Set("Authorization", "Bearer "+qiitaToken)
+	if wantsFreshQiita(ctx) {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
 
-	resp, err := client.Do(req)
+	resp, err := qiitaClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("APIリクエストに失敗しました: %v", err)
+		return nil, fmt.Errorf("APIリクエストに失敗しました: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// レスポンスボディを読み込む
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("レスポンスの読み込みに失敗しました: %v", err)
+		return nil, fmt.Errorf("レスポンスの読み込みに失敗しました: %w", err)
 	}
 
 	// レート制限エラーのチェック
@@ -579,7 +464,11 @@ func (ac *ArticleController) searchArticles(apiURL string) ([]models.Article, er
 		Type    string `json:"type"`
 	}
 	if err := json.Unmarshal(body, &rateLimitError); err == nil && rateLimitError.Type == "rate_limit_exceeded" {
-		return nil, fmt.Errorf("Qiita APIのレート制限に達しました: %s", rateLimitError.Message)
+		return nil, fmt.Errorf("%w: %s", errQiitaRateLimited, rateLimitError.Message)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Qiita APIエラー (%d): %s", resp.StatusCode, string(body))
 	}
 
 	// レスポンスが空の配列かどうかをチェック
@@ -593,7 +482,7 @@ func (ac *ArticleController) searchArticles(apiURL string) ([]models.Article, er
 		// 配列として解析できなかった場合、単一の記事として解析を試みる
 		var article models.Article
 		if err := json.Unmarshal(body, &article); err != nil {
-			return nil, fmt.Errorf("レスポンスの解析に失敗しました: %v", err)
+			return nil, fmt.Errorf("レスポンスの解析に失敗しました: %w", err)
 		}
 		articles = []models.Article{article}
 	}
@@ -601,176 +490,139 @@ func (ac *ArticleController) searchArticles(apiURL string) ([]models.Article, er
 	return articles, nil
 }
 
+// renderSavePage は保存ページを表示する。actionを指定した場合は保存ボタンを表示する
+func renderSavePage(c echo.Context, status int, title, heading, message, action string) error {
+	page := models.PageData{Title: title, Heading: heading, Message: message, Action: action}
+	if action != "" {
+		page.Choices = []models.PageChoice{{Label: "記事を保存する"}}
+	}
+	return c.Render(status, "page.html", page)
+}
+
 // SaveArticle は記事を保存するハンドラー
+// リンクは配信時に署名したもの（saveLink）だけを受け付け、有効期限を過ぎたリンクでは保存できない
 func (ac *ArticleController) SaveArticle(c echo.Context) error {
+	// リンクの署名と有効期限を確認
+	if err := verifySignedParams("/save", c.QueryParams()); err != nil {
+		return renderSavePage(c, http.StatusForbidden, "記事の保存", err.Error(), "配信されたメッセージの保存リンクから開いてください。", "")
+	}
+
 	// パラメータの取得
 	roomID := c.QueryParam("room_id")
 	messageID := c.QueryParam("message_id")
+	itemID := c.QueryParam("item_id")       // ダイジェストの中の記事を保存する場合に指定される
+	accountID := c.QueryParam("account_id") // メンバーの保存リストに保存する場合に指定される
 
-	// 保存ボタンがクリックされた場合
-	if c.Request().Method == "POST" {
-		// Chatworkの設定を取得
-		chatworkToken := os.Getenv("CHATWORK_API_TOKEN")
-		if chatworkToken == "" {
-			return c.String(http.StatusInternalServerError, "CHATWORK_API_TOKENが設定されていません")
-		}
-
-		// Chatworkからメッセージを取得
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", fmt.Sprintf("https://api.chatwork.com/v2/rooms/%s/messages/%s", roomID, messageID), nil)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "リクエストの作成に失敗しました")
-		}
-
-		req.Header.Set("X-ChatWorkToken", chatworkToken)
+	// GETリクエストの場合は保存ページを表示
+	if c.Request().Method != http.MethodPost {
+		return renderSavePage(c, http.StatusOK, "記事の保存", "記事の保存",
+			"以下のボタンをクリックして記事を保存してください。", c.Request().URL.RequestURI())
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "メッセージの取得に失敗しました")
-		}
-		defer resp.Body.Close()
+	// Chatworkの設定を取得
+	chatworkToken := os.Getenv("CHATWORK_API_TOKEN")
+	if chatworkToken == "" {
+		return c.String(http.StatusInternalServerError, "CHATWORK_API_TOKENが設定されていません")
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return c.String(http.StatusInternalServerError, "Chatwork APIからのレスポンスが不正です")
-		}
+	ctx := c.Request().Context()
 
-		// レスポンスを解析
-		var message struct {
-			Body string `json:"body"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
-			return c.String(http.StatusInternalServerError, "メッセージの解析に失敗しました")
-		}
+	// Chatworkからメッセージを取得
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.chatwork.com/v2/rooms/%s/messages/%s",
+		url.PathEscape(roomID),
+		url.PathEscape(messageID)), nil)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "リクエストの作成に失敗しました")
+	}
 
-		// Supabaseの設定を取得
-		supabaseURL := os.Getenv("SUPABASE_URL")
-		supabaseKey := os.Getenv("SUPABASE_KEY")
+	req.Header.Set("X-ChatWorkToken", chatworkToken)
 
-		if supabaseURL == "" || supabaseKey == "" {
-			return c.String(http.StatusInternalServerError, "Supabaseの設定が完了していません")
-		}
+	resp, err := chatworkClient.Do(req)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "メッセージの取得に失敗しました")
+	}
+	defer resp.Body.Close()
 
-		// 既存の記事をチェック
-		checkReq, err := http.NewRequest("GET",
-			fmt.Sprintf("%s/rest/v1/reserve_article?room_id=eq.%s&content=eq.%s",
-				supabaseURL,
-				url.QueryEscape(roomID),
-				url.QueryEscape(message.Body)),
-			nil)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "チェックリクエストの作成に失敗しました")
-		}
+	if resp.StatusCode != http.StatusOK {
+		return c.String(http.StatusInternalServerError, "Chatwork APIからのレスポンスが不正です")
+	}
 
-		checkReq.Header.Set("apikey", supabaseKey)
-		checkReq.Header.Set("Authorization", "Bearer "+supabaseKey)
+	// レスポンスを解析
+	var message struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return c.String(http.StatusInternalServerError, "メッセージの解析に失敗しました")
+	}
 
-		checkResp, err := client.Do(checkReq)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "記事のチェックに失敗しました")
+	// ダイジェストの場合は指定された記事の部分だけを保存する
+	if itemID != "" {
+		content, ok := extractDigestItem(message.Body, itemID)
+		if !ok {
+			return c.String(http.StatusNotFound, "ダイジェストに指定された記事が見つかりません")
 		}
-		defer checkResp.Body.Close()
+		message.Body = content
+	}
 
-		var existingArticles []map[string]interface{}
-		if err := json.NewDecoder(checkResp.Body).Decode(&existingArticles); err != nil {
-			return c.String(http.StatusInternalServerError, "チェックレスポンスの解析に失敗しました")
-		}
+	// 既存の記事をチェック
+	ownerFilter := "account_id=is.null"
+	if accountID != "" {
+		ownerFilter = "account_id=eq." + url.QueryEscape(accountID)
+	}
+	checkReq, err := newSupabaseRequest(ctx, "GET",
+		fmt.Sprintf("reserve_article?room_id=eq.%s&content=eq.%s&%s",
+			url.QueryEscape(roomID),
+			url.QueryEscape(message.Body),
+			ownerFilter),
+		nil)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "チェックリクエストの作成に失敗しました")
+	}
 
-		// 既に保存されている場合は成功として扱う
-		if len(existingArticles) > 0 {
-			return c.HTML(http.StatusOK, `
-				<html>
-					<head>
-						<title>保存完了</title>
-						<meta charset="utf-8">
-					</head>
-					<body>
-						<h1>記事は既に保存されています</h1>
-						<p>このページは閉じて構いません。</p>
-					</body>
-				</html>
-			`)
-		}
+	checkResp, err := supabaseClient.Do(checkReq)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "記事のチェックに失敗しました")
+	}
+	defer checkResp.Body.Close()
 
-		// reserve_articleテーブルに保存
-		articleData := map[string]interface{}{
-			"room_id": roomID,
-			"content": message.Body,
-		}
-		articleJSON, err := json.Marshal(articleData)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "データの作成に失敗しました")
-		}
+	var existingArticles []map[string]interface{}
+	if err := json.NewDecoder(checkResp.Body).Decode(&existingArticles); err != nil {
+		return c.String(http.StatusInternalServerError, "チェックレスポンスの解析に失敗しました")
+	}
 
-		articleReq, err := http.NewRequest("POST", supabaseURL+"/rest/v1/reserve_article", bytes.NewBuffer(articleJSON))
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "リクエストの作成に失敗しました")
-		}
+	// 既に保存されている場合は成功として扱う
+	if len(existingArticles) > 0 {
+		return renderSavePage(c, http.StatusOK, "保存完了", "記事は既に保存されています", "このページは閉じて構いません。", "")
+	}
 
-		articleReq.Header.Set("apikey", supabaseKey)
-		articleReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-		articleReq.Header.Set("Content-Type", "application/json")
-		articleReq.Header.Set("Prefer", "return=minimal")
+	// reserve_articleテーブルに保存
+	articleData := map[string]interface{}{
+		"room_id": roomID,
+		"content": message.Body,
+	}
+	if accountID != "" {
+		articleData["account_id"] = accountID
+	}
+	articleJSON, err := json.Marshal(articleData)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "データの作成に失敗しました")
+	}
 
-		articleResp, err := client.Do(articleReq)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "保存に失敗しました")
-		}
-		defer articleResp.Body.Close()
+	articleReq, err := newSupabaseRequest(ctx, "POST", "reserve_article", bytes.NewBuffer(articleJSON))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "リクエストの作成に失敗しました")
+	}
+	articleReq.Header.Set("Prefer", "return=minimal")
 
-		if articleResp.StatusCode != http.StatusCreated {
-			return c.String(http.StatusInternalServerError, "Supabaseへの保存に失敗しました")
-		}
+	articleResp, err := supabaseClient.Do(articleReq)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "保存に失敗しました")
+	}
+	defer articleResp.Body.Close()
 
-		return c.HTML(http.StatusOK, `
-			<html>
-				<head>
-					<title>保存完了</title>
-					<meta charset="utf-8">
-				</head>
-				<body>
-					<h1>記事を保存しました</h1>
-					<p>このページは閉じて構いません。</p>
-				</body>
-			</html>
-		`)
+	if articleResp.StatusCode != http.StatusCreated {
+		return c.String(http.StatusInternalServerError, "Supabaseへの保存に失敗しました")
 	}
 
-	// GETリクエストの場合は保存ページを表示
-	return c.HTML(http.StatusOK, `
-		<html>
-			<head>
-				<title>記事の保存</title>
-				<meta charset="utf-8">
-				<style>
-					body {
-						font-family: Arial, sans-serif;
-						max-width: 800px;
-						margin: 0 auto;
-						padding: 20px;
-					}
-					.button {
-						display: inline-block;
-						padding: 10px 20px;
-						background-color: #4CAF50;
-						color: white;
-						text-decoration: none;
-						border-radius: 4px;
-						border: none;
-						cursor: pointer;
-						font-size: 16px;
-					}
-					.button:hover {
-						background-color: #45a049;
-					}
-				</style>
-			</head>
-			<body>
-				<h1>記事の保存</h1>
-				<p>以下のボタンをクリックして記事を保存してください。</p>
-				<form method="POST" action="/save?room_id=`+roomID+`&message_id=`+messageID+`">
-					<button type="submit" class="button">記事を保存する</button>
-				</form>
-			</body>
-		</html>
-	`)
+	return renderSavePage(c, http.StatusOK, "保存完了", "記事を保存しました", "このページは閉じて構いません。", "")
 }
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"qiita-search/models"
+	"strings"
+)
+
+// ブロックの種類（興味のないタグ・ミュートした著者・タイトルに含まれる語）
+const (
+	blockKindTag     = "tag"
+	blockKindAuthor  = "author"
+	blockKindKeyword = "keyword"
+)
+
+// blockKindLabels はブロックの種類の表示名
+var blockKindLabels = map[string]string{
+	blockKindTag:     "タグ",
+	blockKindAuthor:  "著者",
+	blockKindKeyword: "タイトルの語",
+}
+
+// roomBlock は room_blockテーブルの1行
+type roomBlock struct {
+	ID     int64  `json:"id,omitempty"`
+	RoomID string `json:"room_id"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+}
+
+// String はブロックを「タグ「ポエム」」のように表示する
+func (b roomBlock) String() string {
+	if b.Kind == blockKindAuthor {
+		return fmt.Sprintf("著者 @%s", b.Value)
+	}
+	return fmt.Sprintf("%s「%s」", blockKindLabels[b.Kind], b.Value)
+}
+
+// newBlock は種類と値を検証し、ルームのブロックを作る
+// タグは表記ゆれを正式なQiitaタグ名に統一し、著者の先頭の「@」は取り除く
+func newBlock(ctx context.Context, roomID, kind, value string) (roomBlock, error) {
+	value = strings.Join(strings.Fields(strings.ReplaceAll(value, "　", " ")), " ")
+	if value == "" {
+		return roomBlock{}, fmt.Errorf("ブロックする値を指定してください")
+	}
+	switch kind {
+	case blockKindTag:
+		if canonical, ok := qiitaTags.aliasTable(ctx).Resolve(value); ok {
+			value = canonical
+		}
+	case blockKindAuthor:
+		value = strings.TrimPrefix(value, "@")
+	case blockKindKeyword:
+	default:
+		return roomBlock{}, fmt.Errorf("ブロックの種類 %q が不正です（tag / author / keyword）", kind)
+	}
+	return roomBlock{RoomID: roomID, Kind: kind, Value: value}, nil
+}
+
+// parseBlock はコマンドの引数（"ポエム"、"tag:ポエム"、"user:xxx"、"@xxx"、"word:転職"）からブロックを作る
+// 種類を省略した場合はタグとして扱う
+func parseBlock(ctx context.Context, roomID, word string) (roomBlock, error) {
+	kind, value := blockKindTag, word
+	if strings.HasPrefix(word, "@") {
+		kind, value = blockKindAuthor, word[1:]
+	} else if prefix, rest, ok := strings.Cut(word, ":"); ok {
+		switch strings.ToLower(strings.TrimSpace(prefix)) {
+		case "tag":
+			kind, value = blockKindTag, rest
+		case "user", "author":
+			kind, value = blockKindAuthor, rest
+		case "word", "keyword", "title":
+			kind, value = blockKindKeyword, rest
+		}
+	}
+	return newBlock(ctx, roomID, kind, value)
+}
+
+// roomBlocks はルームで配信しない記事の条件（種類ごとの値。大文字・小文字は区別しない）
+type roomBlocks map[string]map[string]bool
+
+// blocks は記事がブロックしたタグ・著者・タイトルの語に当てはまるかどうかを返す
+func (b roomBlocks) blocks(article models.Article) bool {
+	if len(b) == 0 {
+		return false
+	}
+	if b[blockKindAuthor][strings.ToLower(article.User.ID)] {
+		return true
+	}
+	for _, tag := range article.Tags {
+		if b[blockKindTag][strings.ToLower(tag.Name)] {
+			return true
+		}
+	}
+	title := strings.ToLower(article.Title)
+	for keyword := range b[blockKindKeyword] {
+		if strings.Contains(title, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchBlocks はルームごとのブロックを取得する。filterには "room_id=eq.xxx" などを指定する
+func fetchBlocks(ctx context.Context, filter string) (map[string]roomBlocks, error) {
+	rows, err := fetchBlockRows(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make(map[string]roomBlocks)
+	for _, row := range rows {
+		if blocks[row.RoomID] == nil {
+			blocks[row.RoomID] = make(roomBlocks)
+		}
+		if blocks[row.RoomID][row.Kind] == nil {
+			blocks[row.RoomID][row.Kind] = make(map[string]bool)
+		}
+		blocks[row.RoomID][row.Kind][strings.ToLower(row.Value)] = true
+	}
+	return blocks, nil
+}
+
+// fetchBlockRows は room_blockテーブルの行を種類・値の順に取得する
+func fetchBlockRows(ctx context.Context, filter string) ([]roomBlock, error) {
+	path := "room_block?select=id,room_id,kind,value&order=kind.asc,value.asc"
+	if filter != "" {
+		path += "&" + filter
+	}
+	var rows []roomBlock
+	if err := getRows(ctx, path, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// addBlock はルームにブロックを追加する。すでに追加されている場合は何もしない
+func addBlock(ctx context.Context, block roomBlock) error {
+	block.ID = 0
+	blockJSON, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	req, err := newSupabaseRequest(ctx, "POST", "room_block", bytes.NewReader(blockJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	resp, err := supabaseClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Supabaseエラー (%d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// removeBlock はルームのブロックを削除する（値の大文字・小文字は区別しない）。見つからなければfalseを返す
+func removeBlock(ctx context.Context, block roomBlock) (bool, error) {
+	rows, err := fetchBlockRows(ctx, "room_id=eq."+url.QueryEscape(block.RoomID)+"&kind=eq."+url.QueryEscape(block.Kind))
+	if err != nil {
+		return false, err
+	}
+	for _, row := range rows {
+		if !strings.EqualFold(row.Value, block.Value) {
+			continue
+		}
+		if err := deleteRows(ctx, fmt.Sprintf("room_block?id=eq.%d", row.ID)); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// blockCommand は /block（ブロックの追加）と /unblock（削除）を実行する
+// 「,」や「、」で区切って複数をまとめて指定できる
+func (uc *UserController) blockCommand(ctx context.Context, roomID, args string, unblock bool) string {
+	words := strings.FieldsFunc(args, func(r rune) bool {
+		return r == ',' || r == '、'
+	})
+	if len(words) == 0 {
+		return "ブロックするタグ・著者・語を指定してください（例: /block ポエム, user:xxx, word:転職）"
+	}
+
+	var replies []string
+	for _, word := range words {
+		block, err := parseBlock(ctx, roomID, strings.TrimSpace(word))
+		if err != nil {
+			replies = append(replies, fmt.Sprintf("・%s: %v", strings.TrimSpace(word), err))
+			continue
+		}
+		if !unblock {
+			if err := addBlock(ctx, block); err != nil {
+				log.Printf("ルーム %s のブロックの追加に失敗しました: %v", roomID, err)
+				replies = append(replies, fmt.Sprintf("・%s のブロックに失敗しました。時間をおいて再度お試しください", block))
+				continue
+			}
+			replies = append(replies, fmt.Sprintf("・%s の記事を配信しないようにしました", block))
+			continue
+		}
+
+		removed, err := removeBlock(ctx, block)
+		switch {
+		case err != nil:
+			log.Printf("ルーム %s のブロックの削除に失敗しました: %v", roomID, err)
+			replies = append(replies, fmt.Sprintf("・%s のブロックの解除に失敗しました。時間をおいて再度お試しください", block))
+		case !removed:
+			replies = append(replies, fmt.Sprintf("・%s はブロックしていません", block))
+		default:
+			replies = append(replies, fmt.Sprintf("・%s のブロックを解除しました", block))
+		}
+	}
+	return strings.Join(replies, "\n")
+}
+
+// listBlocksCommand はルームのブロックの一覧を返す
+func (uc *UserController) listBlocksCommand(ctx context.Context, roomID string) string {
+	rows, err := fetchBlockRows(ctx, "room_id=eq."+url.QueryEscape(roomID))
+	if err != nil {
+		log.Printf("ルーム %s のブロックの取得に失敗しました: %v", roomID, err)
+		return "ブロックの取得に失敗しました。時間をおいて再度お試しください"
+	}
+	if len(rows) == 0 {
+		return "ブロックしているタグ・著者・語はありません。/block タグ名 で追加できます"
+	}
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = "・" + row.String()
+	}
+	return fmt.Sprintf("[info][title]ブロックしているタグ・著者・語（%d件）[/title]%s\n"+
+		"解除する場合は /unblock を送ってください（例: /unblock tag:ポエム）[/info]", len(rows), strings.Join(lines, "\n"))
+}
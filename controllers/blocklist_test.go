@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"qiita-search/models"
+	"reflect"
+	"testing"
+)
+
+// testArticle はブロックの判定に使う項目だけを設定した記事を作る
+func testArticle(title, author string, tags ...string) models.Article {
+	article := models.Article{Title: title}
+	article.User.ID = author
+	for _, tag := range tags {
+		article.Tags = append(article.Tags, models.Tag{Name: tag})
+	}
+	return article
+}
+
+func TestRoomBlocksBlocks(t *testing.T) {
+	blocks := roomBlocks{
+		blockKindTag:     {"ポエム": true, "next.js": true},
+		blockKindAuthor:  {"spammer": true},
+		blockKindKeyword: {"転職": true, "ai agent": true},
+	}
+
+	tests := []struct {
+		name    string
+		blocks  roomBlocks
+		article models.Article
+		want    bool
+	}{
+		{"ブロックなし", nil, testArticle("転職しました", "spammer", "ポエム"), false},
+		{"当てはまらない", blocks, testArticle("Goの並行処理", "alice", "Go"), false},
+		{"タグ", blocks, testArticle("Goの並行処理", "alice", "Go", "ポエム"), true},
+		{"タグは大文字・小文字を区別しない", blocks, testArticle("App Router入門", "alice", "Next.JS"), true},
+		{"著者は大文字・小文字を区別しない", blocks, testArticle("Goの並行処理", "Spammer", "Go"), true},
+		{"タイトルの語", blocks, testArticle("エンジニアの転職活動", "alice", "キャリア"), true},
+		{"タイトルの語は大文字・小文字を区別しない", blocks, testArticle("Building an AI Agent", "alice", "Python"), true},
+		{"タイトルの語はタグには使わない", blocks, testArticle("キャリアの話", "alice", "転職"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.blocks.blocks(tt.article); got != tt.want {
+				t.Errorf("blocks(%q) = %v, want %v", tt.article.Title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBlock(t *testing.T) {
+	tests := []struct {
+		word    string
+		want    roomBlock
+		wantErr bool
+	}{
+		{word: "@alice", want: roomBlock{RoomID: "1", Kind: blockKindAuthor, Value: "alice"}},
+		{word: "user:@alice", want: roomBlock{RoomID: "1", Kind: blockKindAuthor, Value: "alice"}},
+		{word: "author: alice", want: roomBlock{RoomID: "1", Kind: blockKindAuthor, Value: "alice"}},
+		{word: "word:転職　活動", want: roomBlock{RoomID: "1", Kind: blockKindKeyword, Value: "転職 活動"}},
+		{word: "title:ポエム", want: roomBlock{RoomID: "1", Kind: blockKindKeyword, Value: "ポエム"}},
+		{word: "user:", wantErr: true},
+		{word: "word:  ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			got, err := parseBlock(context.Background(), "1", tt.word)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseBlock(%q) = %+v, want error", tt.word, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBlock(%q): %v", tt.word, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseBlock(%q) = %+v, want %+v", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchBlocks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/v1/room_block" || r.URL.Query().Get("room_id") != "in.(1,2)" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		io.WriteString(w, `[
+			{"id": 1, "room_id": "1", "kind": "tag", "value": "Next.js"},
+			{"id": 2, "room_id": "1", "kind": "author", "value": "Spammer"},
+			{"id": 3, "room_id": "2", "kind": "keyword", "value": "転職"}
+		]`)
+	}))
+	defer server.Close()
+	t.Setenv("SUPABASE_URL", server.URL)
+	t.Setenv("SUPABASE_KEY", "test")
+	setupClients()
+
+	got, err := fetchBlocks(context.Background(), "room_id=in.(1,2)")
+	if err != nil {
+		t.Fatalf("fetchBlocks: %v", err)
+	}
+	want := map[string]roomBlocks{
+		"1": {blockKindTag: {"next.js": true}, blockKindAuthor: {"spammer": true}},
+		"2": {blockKindKeyword: {"転職": true}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchBlocks = %v, want %v", got, want)
+	}
+}
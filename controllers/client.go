@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 外部サービスごとのHTTPクライアント
+// タイムアウトは環境変数（例: QIITA_TIMEOUT=10s）で上書きできる
+var (
+	qiitaClient    *http.Client
+	supabaseClient *http.Client
+	chatworkClient *http.Client
+	webhookClient  *http.Client
+
+	// Qiita APIへのリクエストはすべてこのTransportを経由する
+	qiitaRateLimiter *qiitaTransport
+	qiitaCache       *qiitaCacheTransport
+
+	setupClientsOnce sync.Once
+)
+
+// setupClients は.envの読み込み後に環境変数からHTTPクライアントを組み立てる
+func setupClients() {
+	setupClientsOnce.Do(func() {
+		// タイムアウトはリトライの待ち時間を含めず、1回のリクエストごとに適用する
+		qiitaRateLimiter = &qiitaTransport{
+			base:       http.DefaultTransport,
+			timeout:    envDuration("QIITA_TIMEOUT", 15*time.Second),
+			maxRetries: envInt("QIITA_MAX_RETRIES", 3),
+			baseDelay:  envDuration("QIITA_RETRY_BASE_DELAY", 500*time.Millisecond),
+			maxDelay:   envDuration("QIITA_RETRY_MAX_DELAY", 10*time.Second),
+		}
+		// 同じ検索を繰り返さないよう、レート制限の手前でレスポンスをキャッシュする
+		qiitaCache = &qiitaCacheTransport{
+			base:       qiitaRateLimiter,
+			ttl:        envDuration("QIITA_CACHE_TTL", 30*time.Minute),
+			maxEntries: envInt("QIITA_CACHE_MAX_ENTRIES", 2000),
+			dir:        os.Getenv("QIITA_CACHE_DIR"),
+			entries:    make(map[string]*cachedResponse),
+		}
+		if qiitaCache.dir != "" {
+			if err := os.MkdirAll(qiitaCache.dir, 0o755); err != nil {
+				log.Printf("Qiitaキャッシュのディレクトリを作成できません。メモリのみで動作します: %v", err)
+				qiitaCache.dir = ""
+			}
+		}
+		qiitaClient = &http.Client{Transport: qiitaCache}
+		supabaseClient = &http.Client{Timeout: envDuration("SUPABASE_TIMEOUT", 10*time.Second)}
+		chatworkClient = &http.Client{Timeout: envDuration("CHATWORK_TIMEOUT", 10*time.Second)}
+		webhookClient = &http.Client{Timeout: envDuration("WEBHOOK_TIMEOUT", 10*time.Second)}
+	})
+}
+
+// envDuration は環境変数を time.Duration として読み込む
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("%s の値が不正です（%q）。デフォルト値 %s を使用します", key, value, def)
+		return def
+	}
+	return d
+}
+
+// envInt は環境変数を整数として読み込む
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("%s の値が不正です（%q）。デフォルト値 %d を使用します", key, value, def)
+		return def
+	}
+	return n
+}
+
+// newSupabaseRequest はSupabaseのREST APIへのリクエストを作成する
+func newSupabaseRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	supabaseKey := os.Getenv("SUPABASE_KEY")
+	if supabaseURL == "" || supabaseKey == "" {
+		return nil, fmt.Errorf("Supabaseの設定が不足しています")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, supabaseURL+"/rest/v1/"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("apikey", supabaseKey)
+	req.Header.Set("Authorization", "Bearer "+supabaseKey)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// postChatworkMessage はChatworkのルームにメッセージを投稿し、メッセージIDを返す
+func postChatworkMessage(ctx context.Context, roomID, body string) (string, error) {
+	chatworkToken := os.Getenv("CHATWORK_API_TOKEN")
+	if chatworkToken == "" {
+		return "", fmt.Errorf("CHATWORK_API_TOKENが設定されていません")
+	}
+
+	formData := url.Values{}
+	formData.Set("body", body)
+
+	req, err := http.NewRequestWithContext(ctx, "POST",
+		fmt.Sprintf("https://api.chatwork.com/v2/rooms/%s/messages", roomID),
+		strings.NewReader(formData.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("リクエストの作成に失敗しました: %v", err)
+	}
+	req.Header.Set("X-ChatWorkToken", chatworkToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := chatworkClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("メッセージの送信に失敗しました: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("Chatwork APIエラー (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var messageResponse struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&messageResponse); err != nil {
+		return "", fmt.Errorf("レスポンスの解析に失敗しました: %v", err)
+	}
+	return messageResponse.MessageID, nil
+}
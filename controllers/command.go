@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// commandHelp はコマンドの一覧
+const commandHelp = `[info][title]使えるコマンド[/title]` +
+	"/my 分野, 分野 … 自分だけの分野を登録します（記事はあなた宛てに届きます）\n" +
+	"/dm … ダイレクトチャットへの配信を始めます（/dm stop でやめます）\n" +
+	"/fields … 登録済みの分野と、分野数の上限を表示します\n" +
+	"/remove 分野名, 分野名 … 分野を削除します\n" +
+	"/prune … 記事が見つからない分野をまとめて削除します\n" +
+	"/broaden 分野名 … 分野のストック数の条件を緩めます\n" +
+	"/keep 分野名 … 記事が見つからない分野をそのまま残します\n" +
+	"/watch 分野名 [ストック数] … 分野で人気が出始めた記事をすぐにお届けします\n" +
+	"/unwatch 分野名 … 分野のウォッチをやめます\n" +
+	"/block タグ名, user:ID, word:語 … タグ・著者・タイトルの語に当てはまる記事を配信しません\n" +
+	"/unblock タグ名 … ブロックを解除します（/blocks で一覧を表示します）\n" +
+	"/dashboard … 分野を管理するページのリンクを送ります\n" +
+	"/pause 期間 … 配信を一時停止します（例: /pause 7d、/pause 2w、/pause 2026-11-03）\n" +
+	"/resume … 一時停止した配信を再開します\n" +
+	"/leave … このルームへの配信をやめます\n" +
+	"/help … このメッセージを表示します[/info]"
+
+// isCommand はメッセージがコマンド（「/」で始まる）かどうかを返す
+func isCommand(message string) bool {
+	return strings.HasPrefix(strings.TrimSpace(message), "/")
+}
+
+// handleCommand はルームから送られたコマンドを実行し、返信する文言を返す
+// accountIDはコマンドを送ったメンバーで、そのメンバーの分野を優先して操作する
+func (uc *UserController) handleCommand(ctx context.Context, roomID, accountID, message string) string {
+	name, args, _ := strings.Cut(strings.TrimSpace(message), " ")
+	args = strings.TrimSpace(strings.ReplaceAll(args, "　", " "))
+
+	switch strings.ToLower(name) {
+	case "/join":
+		return "このルームはすでに登録されています。分野を送って登録してください"
+	case "/dashboard":
+		return uc.dashboardCommand(roomID)
+	case "/pause":
+		return uc.pauseCommand(ctx, roomID, args)
+	case "/resume":
+		return uc.resumeCommand(ctx, roomID)
+	case "/leave":
+		return uc.leaveCommand(ctx, roomID, args)
+	case "/dm":
+		return uc.directMessageCommand(ctx, accountID, args)
+	case "/my":
+		return uc.myFieldsCommand(ctx, roomID, accountID, args)
+	case "/fields":
+		return uc.listFieldsCommand(ctx, roomID, accountID)
+	case "/prune":
+		return uc.pruneFieldsCommand(ctx, roomID, args)
+	case "/remove":
+		return uc.removeFieldCommand(ctx, roomID, accountID, args)
+	case "/broaden":
+		return uc.broadenFieldCommand(ctx, roomID, accountID, args)
+	case "/keep":
+		return uc.keepFieldCommand(ctx, roomID, accountID, args)
+	case "/watch":
+		return uc.watchFieldCommand(ctx, roomID, accountID, args)
+	case "/unwatch":
+		return uc.unwatchFieldCommand(ctx, roomID, accountID, args)
+	case "/block":
+		return uc.blockCommand(ctx, roomID, args, false)
+	case "/unblock":
+		return uc.blockCommand(ctx, roomID, args, true)
+	case "/blocks":
+		return uc.listBlocksCommand(ctx, roomID)
+	default:
+		return commandHelp
+	}
+}
+
+func (uc *UserController) removeFieldCommand(ctx context.Context, roomID, accountID, args string) string {
+	// 「,」や「、」で区切って複数の分野をまとめて削除できる
+	names := strings.FieldsFunc(args, func(r rune) bool {
+		return r == ',' || r == '、'
+	})
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	var replies []string
+	for _, name := range names {
+		field, reply := lookupFieldForCommand(ctx, roomID, accountID, strings.TrimSpace(name))
+		if field == nil {
+			replies = append(replies, reply)
+			continue
+		}
+		if err := deleteField(ctx, *field); err != nil {
+			log.Printf("分野 %s の削除に失敗しました: %v", field.Name, err)
+			replies = append(replies, fmt.Sprintf("・%s の削除に失敗しました。時間をおいて再度お試しください", field.Name))
+			continue
+		}
+		replies = append(replies, fmt.Sprintf("・%s を削除しました", field.Name))
+	}
+	return strings.Join(replies, "\n")
+}
+
+func (uc *UserController) listFieldsCommand(ctx context.Context, roomID, accountID string) string {
+	room, err := fetchRoom(ctx, roomID)
+	if err != nil {
+		log.Printf("ルーム %s の取得に失敗しました: %v", roomID, err)
+	}
+	fields, err := fetchFields(ctx, "room_id=eq."+url.QueryEscape(roomID)+"&order=priority.desc,field_name.asc")
+	if err != nil {
+		log.Printf("分野情報の取得に失敗しました: %v", err)
+		return "分野の取得に失敗しました。時間をおいて再度お試しください"
+	}
+
+	limit := fieldLimit(room)
+	if len(fields) == 0 {
+		return fmt.Sprintf("登録されている分野はありません（上限 %d件）", limit)
+	}
+
+	lines := make([]string, 0, len(fields))
+	for _, field := range fields {
+		notes := field.notes(accountID)
+		line := fmt.Sprintf("・%s（優先度 %d）", field.Name, field.Priority)
+		if len(notes) > 0 {
+			line += " " + strings.Join(notes, "・")
+		}
+		lines = append(lines, line)
+	}
+	return fmt.Sprintf("[info][title]登録済みの分野（%d / %d件）[/title]%s[/info]", len(fields), limit, strings.Join(lines, "\n"))
+}
+
+// pruneFieldsCommand は記事が見つからなかった分野（削除の確認中、または続けて記事がなかった分野）を示し、
+// /prune confirm でまとめて削除する
+func (uc *UserController) pruneFieldsCommand(ctx context.Context, roomID, args string) string {
+	fields, err := fetchFields(ctx, "room_id=eq."+url.QueryEscape(roomID))
+	if err != nil {
+		log.Printf("分野情報の取得に失敗しました: %v", err)
+		return "分野の取得に失敗しました。時間をおいて再度お試しください"
+	}
+
+	var candidates []fieldInfo
+	for _, field := range fields {
+		if field.ExhaustedAt != nil || field.EmptyStrikes > 0 {
+			candidates = append(candidates, field)
+		}
+	}
+	if len(candidates) == 0 {
+		return "記事が見つからない分野はありません。不要な分野は /remove 分野名 で削除してください"
+	}
+
+	names := make([]string, len(candidates))
+	for i, field := range candidates {
+		names[i] = "・" + field.Name
+	}
+	if !strings.EqualFold(args, "confirm") {
+		return fmt.Sprintf("[info][title]記事が見つからない分野（%d件）[/title]%s\n"+
+			"まとめて削除する場合は /prune confirm を送ってください。[/info]", len(candidates), strings.Join(names, "\n"))
+	}
+
+	var replies []string
+	for _, field := range candidates {
+		if err := deleteField(ctx, field); err != nil {
+			log.Printf("分野 %s の削除に失敗しました: %v", field.Name, err)
+			replies = append(replies, fmt.Sprintf("・%s の削除に失敗しました", field.Name))
+			continue
+		}
+		replies = append(replies, fmt.Sprintf("・%s を削除しました", field.Name))
+	}
+	return strings.Join(replies, "\n")
+}
+
+func (uc *UserController) broadenFieldCommand(ctx context.Context, roomID, accountID, name string) string {
+	field, reply := lookupFieldForCommand(ctx, roomID, accountID, name)
+	if field == nil {
+		return reply
+	}
+
+	if field.isFollow() {
+		return fmt.Sprintf("・%s は新着記事をすべてお届けしているため、条件を緩める必要はありません", field.Name)
+	}
+
+	current := field.minStocks()
+	if current <= 1 {
+		return fmt.Sprintf("・%s はすでにストック数の条件がありません。削除する場合は /remove %s を送ってください", field.Name, field.Name)
+	}
+	broadened := max(current/3, 1)
+
+	err := updateField(ctx, *field, map[string]interface{}{
+		"min_stocks":    broadened,
+		"empty_strikes": 0,
+		"exhausted_at":  nil,
+	})
+	if err != nil {
+		log.Printf("分野 %s の更新に失敗しました: %v", field.Name, err)
+		return fmt.Sprintf("・%s の更新に失敗しました。時間をおいて再度お試しください", field.Name)
+	}
+	return fmt.Sprintf("・%s のストック数の条件を %d 以上から %d 以上に緩めました", field.Name, current, broadened)
+}
+
+func (uc *UserController) keepFieldCommand(ctx context.Context, roomID, accountID, name string) string {
+	field, reply := lookupFieldForCommand(ctx, roomID, accountID, name)
+	if field == nil {
+		return reply
+	}
+
+	err := updateField(ctx, *field, map[string]interface{}{
+		"empty_strikes": 0,
+		"exhausted_at":  nil,
+	})
+	if err != nil {
+		log.Printf("分野 %s の更新に失敗しました: %v", field.Name, err)
+		return fmt.Sprintf("・%s の更新に失敗しました。時間をおいて再度お試しください", field.Name)
+	}
+	return fmt.Sprintf("・%s をこのまま残します", field.Name)
+}
+
+func (uc *UserController) myFieldsCommand(ctx context.Context, roomID, accountID, args string) string {
+	if accountID == "" {
+		return "メンバーを確認できなかったため、自分だけの分野を登録できませんでした"
+	}
+	statuses := uc.registerFields(ctx, roomID, accountID, args)
+	if len(statuses) == 0 {
+		return "登録する分野を指定してください（例: /my Go, Rust）"
+	}
+	return strings.Join(statuses, "\n")
+}
+
+// lookupFieldForCommand はコマンドの対象の分野を探す。見つからない場合は返信する文言を返す
+func lookupFieldForCommand(ctx context.Context, roomID, accountID, name string) (*fieldInfo, string) {
+	if name == "" {
+		return nil, "分野名を指定してください\n" + commandHelp
+	}
+	field, err := findRoomField(ctx, roomID, accountID, name)
+	if err != nil {
+		log.Printf("分野 %s の取得に失敗しました: %v", name, err)
+		return nil, "分野の取得に失敗しました。時間をおいて再度お試しください"
+	}
+	if field == nil {
+		return nil, fmt.Sprintf("・%s は登録されていません", name)
+	}
+	return field, ""
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"qiita-search/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// dashboardPath は分野の管理ページのパス（リンクの署名にも使う）
+const dashboardPath = "/dashboard"
+
+// DashboardController はルームごとの分野の管理ページ
+// ルームに投稿した署名付きリンク（/dashboard）から開き、分野の一覧・優先度の変更・追加・削除、
+// 配信履歴の確認、次の配信のプレビューができる
+type DashboardController struct {
+	articles *ArticleController
+	users    *UserController
+}
+
+func NewDashboardController(ac *ArticleController, uc *UserController) *DashboardController {
+	setupClients()
+	return &DashboardController{articles: ac, users: uc}
+}
+
+// dashboardField は管理ページに表示する分野
+type dashboardField struct {
+	Name      string
+	AccountID string
+	Priority  int
+	Notes     string
+}
+
+// historyEntry は article_historyテーブルの1行
+type historyEntry struct {
+	ArticleURL string     `json:"article_url"`
+	CreatedAt  *time.Time `json:"created_at"` // 配信日時を記録する前の行はnil
+}
+
+// previewArticle は次の配信のプレビューに表示する記事
+type previewArticle struct {
+	Heading string
+	Article models.Article
+}
+
+// dashboardPage は管理ページに渡すデータ
+// Action（フォームの送信先）・PreviewURL・TagsURL・MembersURL は、署名付きのパラメータをそのまま付けたURL
+type dashboardPage struct {
+	models.PageData
+	PreviewURL string
+	TagsURL    string
+	MembersURL string
+	RoomID     string
+	Fields     []dashboardField
+	Limit      int
+	History    []historyEntry
+	Preview    []previewArticle
+	Priorities []int
+}
+
+// membersPage はルームのメンバーのページに渡すデータ
+// Action は管理ページに戻るリンク（署名付きのパラメータをそのまま付けたURL）
+type membersPage struct {
+	models.UserPageData
+	Message string
+	Action  string
+}
+
+// chatworkMember は /v2/rooms/{room_id}/members で取得できるルームのメンバー
+type chatworkMember struct {
+	AccountID int    `json:"account_id"`
+	Name      string `json:"name"`
+}
+
+// dashboardLink はルームの管理ページへの署名付きリンクを返す
+func dashboardLink(roomID string) (string, bool) {
+	return signedLink(dashboardPath, url.Values{"room_id": {roomID}})
+}
+
+// dashboardCommand は /dashboard（管理ページへのリンクを送る）を実行する
+func (uc *UserController) dashboardCommand(roomID string) string {
+	link, ok := dashboardLink(roomID)
+	if !ok {
+		return "LINK_SECRETが設定されていないため、管理ページを開けません"
+	}
+	return fmt.Sprintf("[info][title]分野の管理ページ[/title]"+
+		"分野の優先度の変更・追加・削除、配信履歴の確認、次の配信のプレビューができます（リンクの有効期限: %s）\n%s[/info]",
+		formatDuration(envDuration("LINK_TTL", 30*24*time.Hour)), link)
+}
+
+// verifyRoom はリンクの署名を確認し、ルームを返す。確認できない場合はエラーのページを表示する
+func (dc *DashboardController) verifyRoom(c echo.Context) (*roomSettings, error) {
+	if err := verifySignedParams(dashboardPath, c.QueryParams()); err != nil {
+		return nil, c.Render(http.StatusForbidden, "page.html", models.PageData{
+			Title:   err.Error(),
+			Message: "ルームで /dashboard を送り、新しいリンクから開いてください。",
+		})
+	}
+	roomID := c.QueryParam("room_id")
+	room, err := fetchRoom(c.Request().Context(), roomID)
+	if err != nil || room == nil {
+		if err != nil {
+			log.Printf("ルーム %s の取得に失敗しました: %v", roomID, err)
+		}
+		return nil, c.Render(http.StatusNotFound, "page.html", models.PageData{
+			Title:   "ルームが見つかりません",
+			Message: "ルームが登録されていないか、取得に失敗しました。時間をおいて再度お試しください。",
+		})
+	}
+	return room, nil
+}
+
+// Show は管理ページを表示する
+func (dc *DashboardController) Show(c echo.Context) error {
+	room, err := dc.verifyRoom(c)
+	if room == nil {
+		return err
+	}
+	return dc.render(c, room, "")
+}
+
+// Update は管理ページのフォーム（op=priority / add / remove）を反映し、結果とともに管理ページを表示する
+func (dc *DashboardController) Update(c echo.Context) error {
+	room, err := dc.verifyRoom(c)
+	if room == nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	field := fieldInfo{RoomID: room.RoomID, Name: c.FormValue("field_name"), AccountID: c.FormValue("account_id")}
+
+	var message string
+	switch c.FormValue("op") {
+	case "priority":
+		priority, err := strconv.Atoi(c.FormValue("priority"))
+		if err != nil || priority < minPriority || priority > maxPriority {
+			message = fmt.Sprintf("優先度は %d〜%d で指定してください", minPriority, maxPriority)
+			break
+		}
+		if err := updateField(ctx, field, map[string]interface{}{"priority": priority}); err != nil {
+			log.Printf("分野 %s の優先度の変更に失敗しました: %v", field.Name, err)
+			message = "優先度の変更に失敗しました。時間をおいて再度お試しください"
+			break
+		}
+		message = fmt.Sprintf("%s の優先度を %d に変更しました", field.Name, priority)
+	case "add":
+		statuses := dc.users.registerFields(ctx, room.RoomID, "", c.FormValue("fields"))
+		message = strings.Join(statuses, "\n")
+	case "remove":
+		if err := deleteField(ctx, field); err != nil {
+			log.Printf("分野 %s の削除に失敗しました: %v", field.Name, err)
+			message = "削除に失敗しました。時間をおいて再度お試しください"
+			break
+		}
+		message = fmt.Sprintf("%s を削除しました", field.Name)
+	default:
+		message = "操作を指定してください"
+	}
+	return dc.render(c, room, message)
+}
+
+// Tags はタグの入力補完の候補を返す（フォームの q で始まるタグ）
+func (dc *DashboardController) Tags(c echo.Context) error {
+	if err := verifySignedParams(dashboardPath, c.QueryParams()); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": err.Error()})
+	}
+	tags := qiitaTags.complete(c.Request().Context(), c.FormValue("q"), 10)
+	if tags == nil {
+		tags = []string{}
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+// Preview は次の配信で選ばれる記事を、投稿や配信履歴の記録をせずに表示する
+// 実際の配信では分野がランダムに選ばれるため、結果は毎回変わることがある
+func (dc *DashboardController) Preview(c echo.Context) error {
+	room, err := dc.verifyRoom(c)
+	if room == nil {
+		return err
+	}
+	ac := dc.articles
+	page := dashboardPage{PageData: models.PageData{
+		Title:  "次の配信のプレビュー",
+		Action: dashboardPath + "?" + c.Request().URL.RawQuery,
+	}, RoomID: room.RoomID}
+
+	if !qiitaRateLimiter.waitForQuota(ac.quotaReserve, 0, c.Request().Context().Done()) {
+		page.Message = "Qiita APIの残りリクエスト数が不足しているため、プレビューできません。時間をおいて再度お試しください"
+		return c.Render(http.StatusServiceUnavailable, "preview.html", page)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), ac.roomTimeout)
+	defer cancel()
+
+	fields, err := fetchFields(ctx, "room_id=eq."+url.QueryEscape(room.RoomID))
+	if err != nil {
+		log.Printf("分野情報の取得に失敗しました: %v", err)
+	}
+	// 毎日の配信と同じく、フォローしている分野と削除の確認中の分野は使わない（プレビューでは削除しない）
+	var active []fieldInfo
+	for _, field := range fields {
+		if !field.isFollow() && field.ExhaustedAt == nil {
+			active = append(active, field)
+		}
+	}
+	blocks, err := fetchBlocks(ctx, "room_id=eq."+url.QueryEscape(room.RoomID))
+	if err != nil {
+		log.Printf("ルーム %s のブロックの取得に失敗しました: %v", room.RoomID, err)
+	}
+	room.blocks = blocks[room.RoomID]
+	room.preview = true
+
+	picked, err := ac.pickArticles(ctx, *room, active, ac.digestSize(*room))
+	if err != nil {
+		log.Printf("ルーム %s のプレビューで記事を選べませんでした: %v", room.RoomID, err)
+	}
+	for _, p := range picked {
+		heading, _ := formatArticle(p)
+		page.Preview = append(page.Preview, previewArticle{Heading: heading, Article: p.article})
+	}
+	switch {
+	case !room.wantsDaily():
+		page.Message = "このルームは毎日の配信をしていません（週のまとめのみ）"
+	case len(picked) == 0 && err != nil:
+		page.Message = "記事の検索に失敗しました。時間をおいて再度お試しください"
+	case len(picked) == 0:
+		page.Message = "配信できる新しい記事が見つかりませんでした"
+	}
+	return c.Render(http.StatusOK, "preview.html", page)
+}
+
+// Members はルームのメンバーを表示する（分野のアカウントIDがだれのものかを確認できるようにする）
+func (dc *DashboardController) Members(c echo.Context) error {
+	room, err := dc.verifyRoom(c)
+	if room == nil {
+		return err
+	}
+	page := membersPage{
+		UserPageData: models.UserPageData{Title: "ルームのメンバー"},
+		Action:       dashboardPath + "?" + c.Request().URL.RawQuery,
+	}
+
+	var members []chatworkMember
+	if err := chatworkGet(c.Request().Context(), "rooms/"+url.PathEscape(room.RoomID)+"/members", &members); err != nil {
+		log.Printf("ルーム %s のメンバーの取得に失敗しました: %v", room.RoomID, err)
+		page.Message = "メンバーの取得に失敗しました。時間をおいて再度お試しください"
+		return c.Render(http.StatusServiceUnavailable, "members.html", page)
+	}
+	for _, member := range members {
+		page.Users = append(page.Users, models.User{ID: strconv.Itoa(member.AccountID), Name: member.Name})
+	}
+	return c.Render(http.StatusOK, "members.html", page)
+}
+
+// render はルームの分野と配信履歴を取得して管理ページを表示する
+func (dc *DashboardController) render(c echo.Context, room *roomSettings, message string) error {
+	ctx := c.Request().Context()
+	page := dashboardPage{
+		PageData: models.PageData{
+			Title:   "分野の管理",
+			Message: message,
+			Action:  dashboardPath + "?" + c.Request().URL.RawQuery,
+		},
+		PreviewURL: dashboardPath + "/preview?" + c.Request().URL.RawQuery,
+		TagsURL:    dashboardPath + "/tags?" + c.Request().URL.RawQuery,
+		MembersURL: dashboardPath + "/members?" + c.Request().URL.RawQuery,
+		RoomID:     room.RoomID,
+		Limit:      fieldLimit(room),
+	}
+	for p := minPriority; p <= maxPriority; p++ {
+		page.Priorities = append(page.Priorities, p)
+	}
+
+	fields, err := fetchFields(ctx, "room_id=eq."+url.QueryEscape(room.RoomID)+"&order=priority.desc,field_name.asc")
+	if err != nil {
+		log.Printf("分野情報の取得に失敗しました: %v", err)
+		page.Message = strings.TrimSpace(page.Message + "\n分野の取得に失敗しました")
+	}
+	for _, field := range fields {
+		page.Fields = append(page.Fields, dashboardField{
+			Name:      field.Name,
+			AccountID: field.AccountID,
+			Priority:  field.Priority,
+			Notes:     strings.Join(field.notes(""), "・"),
+		})
+	}
+
+	page.History, err = fetchHistory(ctx, room.RoomID, envInt("DASHBOARD_HISTORY_LIMIT", 30))
+	if err != nil {
+		log.Printf("ルーム %s の配信履歴の取得に失敗しました: %v", room.RoomID, err)
+	}
+	return c.Render(http.StatusOK, "dashboard.html", page)
+}
+
+// fetchHistory はルームの配信履歴を新しい順に最大limit件取得する
+func fetchHistory(ctx context.Context, roomID string, limit int) ([]historyEntry, error) {
+	var history []historyEntry
+	err := getRows(ctx,
+		fmt.Sprintf("article_history?select=article_url,created_at&room_id=eq.%s&order=created_at.desc.nullslast&limit=%d",
+			url.QueryEscape(roomID), limit),
+		&history)
+	if err != nil {
+		return nil, err
+	}
+	for i := range history {
+		if history[i].CreatedAt != nil {
+			createdAt := history[i].CreatedAt.In(jst)
+			history[i].CreatedAt = &createdAt
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,425 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"qiita-search/models"
+	"strings"
+)
+
+// pickedArticle は配信する記事と、その記事を見つけた分野・探し方
+type pickedArticle struct {
+	article  models.Article
+	field    string
+	strategy string
+	// 分野を登録したメンバー（ルーム全体の分野の場合は空）
+	accountID string
+}
+
+// digestSize はルームに1回で送る記事数を返す
+func (ac *ArticleController) digestSize(room roomSettings) int {
+	if room.DigestSize <= 0 {
+		return 1
+	}
+	return min(room.DigestSize, ac.maxDigestSize)
+}
+
+// deliverToRoom は1つのルームに対して記事を選び、要約して投稿する
+// 記事が複数の場合は1つのダイジェストにまとめて投稿する
+func (ac *ArticleController) deliverToRoom(ctx context.Context, room roomSettings, fieldInfos []fieldInfo) (deliveryResult, error) {
+	roomID := room.RoomID
+	result := deliveryResult{RoomID: roomID}
+
+	picked, err := ac.pickArticles(ctx, room, fieldInfos, ac.digestSize(room))
+	if len(picked) == 0 {
+		if err != nil {
+			return result, err
+		}
+		return result, errNoNewArticle
+	}
+	if err != nil {
+		// 一部の記事は見つかっているので、見つかった分だけ配信する
+		log.Printf("ルーム %s の記事の一部を選べませんでした: %v", roomID, err)
+	}
+
+	var summarized []pickedArticle
+	var summarizeErr error
+	for _, p := range picked {
+		if err := p.article.Summarize(ctx); err != nil {
+			log.Printf("記事 %s の要約に失敗しました: %v", p.article.URL, err)
+			summarizeErr = err
+			result.SummaryFailures++
+			continue
+		}
+		summarized = append(summarized, p)
+	}
+	if len(summarized) == 0 {
+		return result, withOutcome(outcomeSummarizerError, summarizeErr)
+	}
+
+	if len(summarized) == 1 {
+		err = postSingleArticle(ctx, roomID, summarized[0])
+	} else {
+		err = postDigest(ctx, roomID, fmt.Sprintf("本日のダイジェスト（%d件）", len(summarized)), summarized)
+	}
+	if err != nil {
+		return result, withOutcome(outcomePostError, err)
+	}
+
+	for _, p := range summarized {
+		result.Articles = append(result.Articles, deliveredArticle{
+			URL:      p.article.URL,
+			Field:    p.field,
+			Strategy: p.strategy,
+		})
+		if err := recordHistory(ctx, roomID, p.article.URL); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// pickArticles は優先度で重み付けした分野から、重複しないように最大n件の記事を選ぶ
+// 分野はできるだけ異なるものを選び、すべて使ったら記事が見つかった分野をもう一度使う
+func (ac *ArticleController) pickArticles(ctx context.Context, room roomSettings, fieldInfos []fieldInfo, n int) ([]pickedArticle, error) {
+	pool := append([]fieldInfo(nil), fieldInfos...)
+	var productive []fieldInfo
+	tried := make(map[string]bool)
+	exclude := make(map[string]bool)
+	// 同じ配信ですでに選んだ記事と、ルームでブロックしたタグ・著者の記事は選ばない
+	skip := func(article models.Article) bool {
+		return exclude[article.URL] || room.blocks.blocks(article)
+	}
+
+	var picked []pickedArticle
+	for attempts := 0; len(picked) < n && attempts < n+len(fieldInfos); attempts++ {
+		if len(pool) == 0 {
+			pool, productive = productive, nil
+		}
+
+		var field *fieldInfo
+		if len(pool) > 0 {
+			i := weightedFieldIndex(pool)
+			selected := pool[i]
+			field = &selected
+			pool = append(pool[:i], pool[i+1:]...)
+		}
+
+		p, found, err := ac.findArticleForField(ctx, room, field, skip, field != nil && !tried[field.Name])
+		if field != nil {
+			tried[field.Name] = true
+		}
+		if err != nil {
+			return picked, err
+		}
+		if !found {
+			if field == nil {
+				// 分野に関係ない探し方でも見つからなければ、これ以上は選べない
+				break
+			}
+			continue
+		}
+
+		exclude[p.article.URL] = true
+		picked = append(picked, p)
+		if field != nil && p.field != "" {
+			productive = append(productive, *field)
+		}
+	}
+	return picked, nil
+}
+
+// weightedFieldIndex は優先度に基づく重み付けランダム選択で分野を1つ選ぶ
+func weightedFieldIndex(fields []fieldInfo) int {
+	// 優先度に基づく重み付け合計を計算
+	totalWeight := 0
+	for _, field := range fields {
+		totalWeight += field.Priority
+	}
+	if totalWeight <= 0 {
+		return rand.Intn(len(fields))
+	}
+
+	// 重み付けランダム選択
+	randomNum := rand.Intn(totalWeight)
+	currentWeight := 0
+	for i, field := range fields {
+		currentWeight += field.Priority
+		if randomNum < currentWeight {
+			return i
+		}
+	}
+	return len(fields) - 1
+}
+
+// findArticleForField はルームに設定された探し方を順に試して記事を1件探す
+// fieldがnilの場合は分野に関係ない探し方だけを使う。countStrikeがtrueの場合は、
+// 分野で見つからなかったことを記録する（同じ配信で2回目に使う分野は記録しない）
+func (ac *ArticleController) findArticleForField(ctx context.Context, room roomSettings, field *fieldInfo, skip func(models.Article) bool, countStrike bool) (pickedArticle, bool, error) {
+	roomID := room.RoomID
+
+	var expr *models.FieldExpr
+	minStocks := defaultMinStocks
+	if field != nil {
+		// 分野の式を解析（登録済みの表記ゆれも正式なタグ名に変換して検索する）
+		expr = parseStoredField(ctx, field.Name)
+		minStocks = field.minStocks()
+	}
+
+	fieldSearched := false
+	fieldExhausted := false
+	exhaust := func() error {
+		fieldExhausted = true
+		if !countStrike || room.preview {
+			return nil
+		}
+		if err := ac.exhaustField(ctx, *field); err != nil {
+			return withOutcome(outcomeUpstreamError, err)
+		}
+		return nil
+	}
+
+	for _, strategy := range parseSearchStrategies(room.SearchStrategy) {
+		if strategy.usesField() {
+			if expr == nil || fieldExhausted {
+				continue
+			}
+			fieldSearched = true
+		} else if fieldSearched && !fieldExhausted {
+			// 分野での検索で見つからなかったため、記録してから分野に関係ない探し方に進む
+			if err := exhaust(); err != nil {
+				return pickedArticle{}, false, err
+			}
+		}
+
+		query, ok, err := ac.strategyQuery(ctx, strategy, expr, minStocks)
+		if err != nil {
+			// 関連タグを調べられなかった場合も、分野で記事が見つからなかったとは記録しない
+			return pickedArticle{}, false, err
+		}
+		if !ok {
+			continue
+		}
+
+		var article models.Article
+		var found bool
+		if strategy.Name == strategyTrending {
+			// 新しい順ではなく、伸びが大きい順に選ぶ
+			article, found, err = ac.findTrendingArticle(ctx, roomID, strategy.Pages, query, skip)
+		} else {
+			article, found, err = ac.findNewArticle(ctx, roomID, strategy.Pages, skip, func(page int) string {
+				return qiitaSearchURL(page, query)
+			})
+		}
+		if err != nil {
+			// タイムアウトやレート制限で検索できなかった場合は分野を削除しない
+			return pickedArticle{}, false, err
+		}
+		if !found {
+			continue
+		}
+
+		p := pickedArticle{article: article, strategy: strategy.Name}
+		if strategy.Name == strategyTrending && expr != nil {
+			p.field, p.accountID = field.Name, field.AccountID
+		}
+		if strategy.usesField() {
+			p.field, p.accountID = field.Name, field.AccountID
+			if field.EmptyStrikes > 0 && !room.preview {
+				// 見つからなかった回数は連続した回数だけを数える
+				if err := updateField(ctx, *field, map[string]interface{}{"empty_strikes": 0}); err != nil {
+					log.Printf("分野 %s の記録の更新に失敗しました: %v", field.Name, err)
+				}
+				field.EmptyStrikes = 0
+			}
+		}
+		return p, true, nil
+	}
+
+	if fieldSearched && !fieldExhausted {
+		if err := exhaust(); err != nil {
+			return pickedArticle{}, false, err
+		}
+	}
+	return pickedArticle{}, false, nil
+}
+
+// formatArticle は記事の見出し・タイトル・URL・要約・タグを投稿用の文面にする
+func formatArticle(p pickedArticle) (string, string) {
+	tags := make([]string, len(p.article.Tags))
+	for i, tag := range p.article.Tags {
+		tags[i] = tag.Name
+	}
+	tagMessage := ""
+	if len(tags) > 0 {
+		tagMessage = "\nタグ: " + strings.Join(tags, ", ")
+	}
+
+	heading := "本日の記事"
+	switch {
+	case p.strategy == strategyFollow:
+		heading = fmt.Sprintf("「%s」の新着記事", p.field)
+	case p.strategy == strategyWatch:
+		heading = fmt.Sprintf("「%s」で人気が出始めた記事", p.field)
+	case p.field != "":
+		heading = fmt.Sprintf("「%s」の記事", p.field)
+	}
+
+	return heading, fmt.Sprintf("%s\n%s\n\n%s%s",
+		p.article.Title,
+		p.article.URL,
+		p.article.Summary,
+		tagMessage)
+}
+
+// mention は分野を登録したメンバーへの宛先（[To:account_id]）を返す。ルーム全体の分野の場合は空
+func mention(accountID string) string {
+	if accountID == "" {
+		return ""
+	}
+	return "[To:" + accountID + "]\n"
+}
+
+// saveLink は記事の保存ページへの署名付きリンクを返す。itemIDはダイジェストの中の記事を指定する場合に、
+// accountIDはメンバーの分野の記事をそのメンバーの保存リストに入れる場合に使う
+// LINK_SECRET が設定されていない場合は空を返す
+func saveLink(roomID, messageID, itemID, accountID string) string {
+	params := url.Values{
+		"room_id":    {roomID},
+		"message_id": {messageID},
+	}
+	if itemID != "" {
+		params.Set("item_id", itemID)
+	}
+	if accountID != "" {
+		params.Set("account_id", accountID)
+	}
+	link, ok := signedLink("/save", params)
+	if !ok {
+		log.Printf("LINK_SECRETが設定されていないため、保存リンクを作成できません")
+		return ""
+	}
+	return link
+}
+
+// articleLinks は記事の保存リンクとフィードバックのリンクを改行でつなげて返す
+func articleLinks(roomID, messageID, itemID string, p pickedArticle) string {
+	var links []string
+	for _, link := range []string{saveLink(roomID, messageID, itemID, p.accountID), feedbackLinks(roomID, p)} {
+		if link != "" {
+			links = append(links, link)
+		}
+	}
+	return strings.Join(links, "\n")
+}
+
+// postSingleArticle は1件の記事と、その保存リンクを投稿する
+func postSingleArticle(ctx context.Context, roomID string, p pickedArticle) error {
+	heading, body := formatArticle(p)
+
+	// 最初のメッセージを送信
+	initialMessage := fmt.Sprintf("%s[info][title]%s[/title]%s[/info]", mention(p.accountID), heading, body)
+	messageID, err := postChatworkMessage(ctx, roomID, initialMessage)
+	if err != nil {
+		return err
+	}
+
+	// 保存リンクとフィードバックのリンクを含むメッセージを送信
+	links := articleLinks(roomID, messageID, "", p)
+	if links == "" {
+		return nil
+	}
+	saveLinkMessage := fmt.Sprintf("[info]保存する場合は以下のリンクをクリック！！\n%s\nアプリはこちら！\nhttps://techapp-h845.onrender.com[/info]",
+		links)
+	_, err = postChatworkMessage(ctx, roomID, saveLinkMessage)
+	return err
+}
+
+// digestSeparator はダイジェストの記事の区切り
+const digestSeparator = "[hr]"
+
+// postDigest は複数の記事を1つのメッセージにまとめて投稿し、記事ごとの保存リンクを投稿する
+func postDigest(ctx context.Context, roomID, title string, picked []pickedArticle) error {
+	sections := make([]string, len(picked))
+	for i, p := range picked {
+		heading, body := formatArticle(p)
+		sections[i] = fmt.Sprintf("%d. %s\n%s", i+1, heading, body)
+	}
+
+	// メンバーの分野から選んだ記事がある場合は、そのメンバーに宛てる
+	var mentions []string
+	mentioned := make(map[string]bool)
+	for _, p := range picked {
+		if p.accountID != "" && !mentioned[p.accountID] {
+			mentioned[p.accountID] = true
+			mentions = append(mentions, mention(p.accountID))
+		}
+	}
+
+	digestMessage := fmt.Sprintf("%s[info][title]%s[/title]%s[/info]",
+		strings.Join(mentions, ""),
+		title,
+		strings.Join(sections, digestSeparator))
+	messageID, err := postChatworkMessage(ctx, roomID, digestMessage)
+	if err != nil {
+		return err
+	}
+
+	var links []string
+	for i, p := range picked {
+		if link := articleLinks(roomID, messageID, p.article.ID, p); link != "" {
+			links = append(links, fmt.Sprintf("%d. %s\n%s", i+1, p.article.Title, link))
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	saveLinkMessage := fmt.Sprintf("[info]保存する場合は以下のリンクをクリック！！\n%s\nアプリはこちら！\nhttps://techapp-h845.onrender.com[/info]",
+		strings.Join(links, "\n"))
+	_, err = postChatworkMessage(ctx, roomID, saveLinkMessage)
+	return err
+}
+
+// extractDigestItem はダイジェストのメッセージ本文から、itemIDの記事の部分を取り出す
+func extractDigestItem(body, itemID string) (string, bool) {
+	for _, section := range strings.Split(body, digestSeparator) {
+		if !strings.Contains(section, "/items/"+itemID) {
+			continue
+		}
+		section = strings.NewReplacer("[info]", "", "[/info]", "").Replace(section)
+		if _, rest, ok := strings.Cut(section, "[/title]"); ok {
+			section = rest
+		}
+		return strings.TrimSpace(section), true
+	}
+	return "", false
+}
+
+// recordHistory は記事をルームへの配信履歴に追加する
+func recordHistory(ctx context.Context, roomID, articleURL string) error {
+	historyData := map[string]interface{}{
+		"article_url": articleURL,
+		"room_id":     roomID,
+	}
+	historyJSON, err := json.Marshal(historyData)
+	if err != nil {
+		return err
+	}
+
+	historyPostReq, err := newSupabaseRequest(ctx, "POST", "article_history", bytes.NewReader(historyJSON))
+	if err != nil {
+		return err
+	}
+
+	historyPostResp, err := supabaseClient.Do(historyPostReq)
+	if err != nil {
+		return err
+	}
+	historyPostResp.Body.Close()
+	return nil
+}
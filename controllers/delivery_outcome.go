@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// deliveryOutcome は1ルームへの配信処理の結果の種類
+type deliveryOutcome string
+
+const (
+	outcomeFound           deliveryOutcome = "found"            // 記事を配信した
+	outcomeExhausted       deliveryOutcome = "exhausted"        // 未配信の記事が本当に見つからなかった
+	outcomeUpstreamError   deliveryOutcome = "upstream_error"   // Qiita・Supabaseの呼び出しやタイムアウトで失敗した
+	outcomeRateLimited     deliveryOutcome = "rate_limited"     // Qiita APIのレート制限に達した
+	outcomeSummarizerError deliveryOutcome = "summarizer_error" // Geminiでの要約に失敗した
+	outcomePostError       deliveryOutcome = "post_error"       // Chatworkへの投稿に失敗した
+	outcomePaused          deliveryOutcome = "paused"           // ルームが一時停止中のため配信しなかった
+)
+
+// deliveryError は配信処理の失敗と、その種類
+type deliveryError struct {
+	outcome deliveryOutcome
+	err     error
+}
+
+func (e *deliveryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.outcome, e.err)
+}
+
+func (e *deliveryError) Unwrap() error {
+	return e.err
+}
+
+// withOutcome はエラーに失敗の種類を付ける。すでに種類が付いている場合はそのまま返す
+func withOutcome(outcome deliveryOutcome, err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *deliveryError
+	if errors.As(err, &de) {
+		return err
+	}
+	return &deliveryError{outcome: outcome, err: err}
+}
+
+// classifyOutcome は配信処理の戻り値から結果の種類を判定する
+func classifyOutcome(err error) deliveryOutcome {
+	var de *deliveryError
+	switch {
+	case err == nil:
+		return outcomeFound
+	case errors.Is(err, errNoNewArticle):
+		return outcomeExhausted
+	case errors.Is(err, errQiitaRateLimited):
+		return outcomeRateLimited
+	case errors.As(err, &de):
+		return de.outcome
+	default:
+		// タイムアウトを含め、種類の分からない失敗は外部サービスの失敗として扱う
+		return outcomeUpstreamError
+	}
+}
+
+// isFailure は管理者に知らせるべき失敗かどうかを返す
+func (o deliveryOutcome) isFailure() bool {
+	return o != outcomeFound && o != outcomeExhausted
+}
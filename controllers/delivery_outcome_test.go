@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyOutcome(t *testing.T) {
+	upstream := errors.New("connection reset")
+	tests := []struct {
+		name string
+		err  error
+		want deliveryOutcome
+	}{
+		{"成功", nil, outcomeFound},
+		{"記事なし", errNoNewArticle, outcomeExhausted},
+		{"記事なし（ラップ）", fmt.Errorf("分野 Go: %w", errNoNewArticle), outcomeExhausted},
+		{"レート制限", fmt.Errorf("%w: limit", errQiitaRateLimited), outcomeRateLimited},
+		{"レート制限（種類付き）", withOutcome(outcomeUpstreamError, errQiitaRateLimited), outcomeRateLimited},
+		{"要約の失敗", withOutcome(outcomeSummarizerError, upstream), outcomeSummarizerError},
+		{"投稿の失敗", withOutcome(outcomePostError, upstream), outcomePostError},
+		{"種類付きのエラーをラップ", fmt.Errorf("ルーム 1: %w", withOutcome(outcomePostError, upstream)), outcomePostError},
+		{"最初に付けた種類を使う", withOutcome(outcomeUpstreamError, withOutcome(outcomeSummarizerError, upstream)), outcomeSummarizerError},
+		{"種類の分からないエラー", upstream, outcomeUpstreamError},
+		{"タイムアウト", context.DeadlineExceeded, outcomeUpstreamError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyOutcome(tt.err); got != tt.want {
+				t.Errorf("classifyOutcome(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithOutcomeKeepsCause(t *testing.T) {
+	if withOutcome(outcomePostError, nil) != nil {
+		t.Error("withOutcome(nil) がnilを返しませんでした")
+	}
+	cause := errors.New("chatwork 500")
+	if err := withOutcome(outcomePostError, cause); !errors.Is(err, cause) {
+		t.Errorf("withOutcome() = %v, 元のエラーを errors.Is で確認できません", err)
+	}
+}
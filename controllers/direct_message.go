@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// chatworkContact は /v2/contacts で取得できるコンタクト
+type chatworkContact struct {
+	AccountID int    `json:"account_id"`
+	RoomID    int    `json:"room_id"` // コンタクトとのダイレクトチャットのルームID
+	Name      string `json:"name"`
+}
+
+// chatworkIncomingRequest は /v2/incoming_requests で取得できるコンタクト承認依頼
+type chatworkIncomingRequest struct {
+	RequestID int `json:"request_id"`
+	AccountID int `json:"account_id"`
+}
+
+// chatworkGet はChatwork APIにGETリクエストを送り、レスポンスをvに読み込む
+func chatworkGet(ctx context.Context, path string, v interface{}) error {
+	return chatworkDo(ctx, "GET", path, v)
+}
+
+// chatworkDo はChatwork APIにリクエストを送り、レスポンスをvに読み込む（vがnilの場合は読み込まない）
+func chatworkDo(ctx context.Context, method, path string, v interface{}) error {
+	chatworkToken := os.Getenv("CHATWORK_API_TOKEN")
+	if chatworkToken == "" {
+		return fmt.Errorf("CHATWORK_API_TOKENが設定されていません")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "https://api.chatwork.com/v2/"+path, nil)
+	if err != nil {
+		return fmt.Errorf("リクエストの作成に失敗しました: %v", err)
+	}
+	req.Header.Set("X-ChatWorkToken", chatworkToken)
+
+	resp, err := chatworkClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Chatwork APIリクエストに失敗しました: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 該当するデータがない場合、Chatwork APIは204を返す
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Chatwork APIエラー (%d): %s", resp.StatusCode, string(body))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// findDirectRoom はメンバーとのダイレクトチャットのルームIDを探す
+// まだコンタクトでない場合は、メンバーからのコンタクト承認依頼があれば承認してから探す。見つからなければ空を返す
+func findDirectRoom(ctx context.Context, accountID string) (string, error) {
+	id, err := strconv.Atoi(accountID)
+	if err != nil {
+		return "", fmt.Errorf("アカウントID %q が不正です", accountID)
+	}
+
+	var contacts []chatworkContact
+	if err := chatworkGet(ctx, "contacts", &contacts); err != nil {
+		return "", err
+	}
+	for _, contact := range contacts {
+		if contact.AccountID == id {
+			return strconv.Itoa(contact.RoomID), nil
+		}
+	}
+
+	var requests []chatworkIncomingRequest
+	if err := chatworkGet(ctx, "incoming_requests", &requests); err != nil {
+		return "", err
+	}
+	for _, request := range requests {
+		if request.AccountID != id {
+			continue
+		}
+		// 承認するとダイレクトチャットが作られ、レスポンスにルームIDが含まれる
+		var approved chatworkContact
+		if err := chatworkDo(ctx, "PUT", fmt.Sprintf("incoming_requests/%d", request.RequestID), &approved); err != nil {
+			return "", err
+		}
+		if approved.RoomID == 0 {
+			return "", fmt.Errorf("承認したコンタクトのルームIDを取得できませんでした")
+		}
+		return strconv.Itoa(approved.RoomID), nil
+	}
+	return "", nil
+}
+
+// directMessageCommand は /dm（ダイレクトチャットへの配信を始める）と /dm stop（やめる）を実行する
+// ダイレクトチャットは独立したルームとして登録するため、分野や配信の頻度もグループのルームとは別に設定できる
+func (uc *UserController) directMessageCommand(ctx context.Context, accountID, args string) string {
+	if accountID == "" {
+		return "メンバーを確認できなかったため、ダイレクトチャットへの配信を設定できませんでした"
+	}
+
+	switch strings.ToLower(args) {
+	case "":
+		return startDirectDelivery(ctx, accountID)
+	case "stop", "off":
+		return stopDirectDelivery(ctx, accountID)
+	default:
+		return "ダイレクトチャットへの配信を始める場合は /dm、やめる場合は /dm stop を送ってください"
+	}
+}
+
+func startDirectDelivery(ctx context.Context, accountID string) string {
+	roomID, err := findDirectRoom(ctx, accountID)
+	if err != nil {
+		log.Printf("アカウント %s のダイレクトチャットの取得に失敗しました: %v", accountID, err)
+		return "ダイレクトチャットを確認できませんでした。時間をおいて再度お試しください"
+	}
+	if roomID == "" {
+		return mention(accountID) + "ダイレクトチャットが見つかりませんでした。このボットにコンタクト追加を申請してから、もう一度 /dm を送ってください"
+	}
+
+	userData := map[string]interface{}{
+		"room_id":    roomID,
+		"account_id": accountID,
+	}
+	userJSON, err := json.Marshal(userData)
+	if err != nil {
+		return "登録に失敗しました"
+	}
+	req, err := newSupabaseRequest(ctx, "POST", "user", bytes.NewReader(userJSON))
+	if err != nil {
+		return "登録に失敗しました"
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	resp, err := supabaseClient.Do(req)
+	if err != nil {
+		log.Printf("ダイレクトチャット %s の登録に失敗しました: %v", roomID, err)
+		return "登録に失敗しました。時間をおいて再度お試しください"
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return mention(accountID) + "ダイレクトチャットへの配信はすでに始まっています"
+	}
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("ダイレクトチャット %s の登録に失敗しました (%d): %s", roomID, resp.StatusCode, string(body))
+		return "登録に失敗しました。時間をおいて再度お試しください"
+	}
+
+	welcome := "[info][title]ダイレクトチャットへの配信を始めました[/title]" +
+		"このチャットに分野（例: Go, Rust）を送ると、あなただけの記事をお届けします。\n" +
+		"使えるコマンドは /help で確認できます。配信をやめる場合は /dm stop を送ってください。[/info]"
+	if _, err := postChatworkMessage(ctx, roomID, welcome); err != nil {
+		log.Printf("ダイレクトチャット %s への案内の送信に失敗しました: %v", roomID, err)
+	}
+	return mention(accountID) + "ダイレクトチャットへの配信を始めました。分野はダイレクトチャットで登録してください"
+}
+
+// stopDirectDelivery はメンバーのダイレクトチャットへの配信をやめる
+// /leave と同じく分野・配信履歴・ブロックを先に削除し、途中で失敗してもルームが残って再度実行できるようにする
+func stopDirectDelivery(ctx context.Context, accountID string) string {
+	var rooms []roomSettings
+	if err := getRows(ctx, "user?select=room_id&account_id=eq."+url.QueryEscape(accountID), &rooms); err != nil {
+		log.Printf("アカウント %s のダイレクトチャットの取得に失敗しました: %v", accountID, err)
+		return "解除に失敗しました。時間をおいて再度お試しください"
+	}
+	if len(rooms) == 0 {
+		return mention(accountID) + "ダイレクトチャットへの配信は登録されていません"
+	}
+
+	for _, room := range rooms {
+		for _, path := range []string{
+			"field?room_id=eq." + url.QueryEscape(room.RoomID),
+			"article_history?room_id=eq." + url.QueryEscape(room.RoomID),
+			"room_block?room_id=eq." + url.QueryEscape(room.RoomID),
+			"user?room_id=eq." + url.QueryEscape(room.RoomID),
+		} {
+			if err := deleteRows(ctx, path); err != nil {
+				log.Printf("ダイレクトチャット %s の削除に失敗しました（%s）: %v", room.RoomID, path, err)
+				return "解除に失敗しました。時間をおいて再度お試しください"
+			}
+		}
+	}
+	return mention(accountID) + "ダイレクトチャットへの配信をやめました"
+}
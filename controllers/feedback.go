@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"qiita-search/models"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// フィードバックの種類
+const (
+	feedbackMore  = "more"  // 分野の優先度を上げる
+	feedbackLess  = "less"  // 分野の優先度を下げる
+	feedbackBlock = "block" // タグ・著者をブロックする
+)
+
+// 分野の優先度の範囲（登録時は3）
+const (
+	minPriority = 1
+	maxPriority = 5
+)
+
+// feedbackLinks は配信した記事へのフィードバック用の署名付きリンクを返す
+// 分野から選んだ記事では優先度の上げ下げ、すべての記事でタグ・著者のブロックができる
+// LINK_SECRET が設定されていない場合は空を返す
+func feedbackLinks(roomID string, p pickedArticle) string {
+	var lines []string
+	link := func(label string, params url.Values) {
+		params.Set("room_id", roomID)
+		if href, ok := signedLink("/feedback", params); ok {
+			lines = append(lines, label+": "+href)
+		}
+	}
+
+	// フォローしている分野は新着記事をすべて届けるため、優先度は使わない
+	if p.field != "" && p.strategy != strategyFollow {
+		for _, action := range []struct{ label, name string }{
+			{"👍 この分野をもっと", feedbackMore},
+			{"👎 この分野を減らす", feedbackLess},
+		} {
+			link(action.label, url.Values{
+				"action":     {action.name},
+				"field":      {p.field},
+				"account_id": {p.accountID},
+			})
+		}
+	}
+
+	tags := make([]string, len(p.article.Tags))
+	for i, tag := range p.article.Tags {
+		tags[i] = tag.Name
+	}
+	link("🚫 興味なし（タグ・著者）", url.Values{
+		"action": {feedbackBlock},
+		"tags":   {strings.Join(tags, ",")},
+		"author": {p.article.User.ID},
+	})
+	return strings.Join(lines, "\n")
+}
+
+// renderFeedbackPage はフィードバックのページを表示する
+func renderFeedbackPage(c echo.Context, status int, title, message, action string, choices []models.PageChoice) error {
+	return c.Render(status, "page.html", models.PageData{
+		Title:   title,
+		Message: message,
+		Action:  action,
+		Choices: choices,
+	})
+}
+
+// Feedback は配信した記事へのフィードバック（分野の優先度の上げ下げ、タグ・著者のブロック）のハンドラー
+// GETでは確認ページを表示し、POSTで反映する。リンクは LINK_SECRET で署名されたものだけを受け付ける
+func (ac *ArticleController) Feedback(c echo.Context) error {
+	params := c.QueryParams()
+	if err := verifySignedParams("/feedback", params); err != nil {
+		return renderFeedbackPage(c, http.StatusForbidden, err.Error(), "配信されたメッセージのリンクから開いてください。", "", nil)
+	}
+	roomID := params.Get("room_id")
+	action := c.Request().URL.RequestURI()
+
+	switch params.Get("action") {
+	case feedbackMore, feedbackLess:
+		field := fieldInfo{RoomID: roomID, Name: params.Get("field"), AccountID: params.Get("account_id")}
+		more := params.Get("action") == feedbackMore
+		if c.Request().Method != http.MethodPost {
+			label, message := "この分野の記事を増やす", fmt.Sprintf("分野「%s」の優先度を上げ、記事が選ばれやすくします。", field.Name)
+			if !more {
+				label, message = "この分野の記事を減らす", fmt.Sprintf("分野「%s」の優先度を下げ、記事が選ばれにくくします。", field.Name)
+			}
+			return renderFeedbackPage(c, http.StatusOK, "分野の優先度の変更", message, action,
+				[]models.PageChoice{{Label: label, Name: "confirm", Value: "1"}})
+		}
+		message, err := adjustFieldPriority(c.Request().Context(), field, more)
+		if err != nil {
+			log.Printf("分野 %s の優先度の変更に失敗しました: %v", field.Name, err)
+			return renderFeedbackPage(c, http.StatusInternalServerError, "変更に失敗しました", "時間をおいて再度お試しください。", "", nil)
+		}
+		return renderFeedbackPage(c, http.StatusOK, "フィードバックを受け付けました", message+"このページは閉じて構いません。", "", nil)
+
+	case feedbackBlock:
+		var choices []models.PageChoice
+		for _, tag := range strings.Split(params.Get("tags"), ",") {
+			if tag != "" {
+				choices = append(choices, models.PageChoice{Label: fmt.Sprintf("タグ「%s」の記事を配信しない", tag), Name: blockKindTag, Value: tag})
+			}
+		}
+		if author := params.Get("author"); author != "" {
+			choices = append(choices, models.PageChoice{Label: fmt.Sprintf("@%s さんの記事を配信しない", author), Name: blockKindAuthor, Value: author})
+		}
+		if c.Request().Method != http.MethodPost {
+			return renderFeedbackPage(c, http.StatusOK, "興味のない記事の設定",
+				"選んだタグ・著者の記事は、このルームに配信しなくなります。", action, choices)
+		}
+
+		// 署名したリンクに含まれるタグ・著者だけをブロックできる
+		for _, choice := range choices {
+			if c.FormValue(choice.Name) != choice.Value {
+				continue
+			}
+			block := roomBlock{RoomID: roomID, Kind: choice.Name, Value: choice.Value}
+			if err := addBlock(c.Request().Context(), block); err != nil {
+				log.Printf("ルーム %s のブロックの追加に失敗しました: %v", roomID, err)
+				return renderFeedbackPage(c, http.StatusInternalServerError, "設定に失敗しました", "時間をおいて再度お試しください。", "", nil)
+			}
+			return renderFeedbackPage(c, http.StatusOK, "フィードバックを受け付けました",
+				choice.Label+"ようにしました。このページは閉じて構いません。", "", nil)
+		}
+		return renderFeedbackPage(c, http.StatusBadRequest, "設定に失敗しました", "リンクに含まれないタグ・著者は指定できません。", "", nil)
+	}
+	return renderFeedbackPage(c, http.StatusBadRequest, "リンクが無効です", "配信されたメッセージのリンクから開いてください。", "", nil)
+}
+
+// adjustFieldPriority は分野の優先度を1つ上げる（moreがfalseの場合は下げる）
+func adjustFieldPriority(ctx context.Context, field fieldInfo, more bool) (string, error) {
+	fields, err := fetchFields(ctx, fieldFilter(field))
+	if err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return fmt.Sprintf("分野「%s」はすでに削除されています。", field.Name), nil
+	}
+	field = fields[0]
+
+	priority := field.Priority + 1
+	if !more {
+		priority = field.Priority - 1
+	}
+	priority = min(max(priority, minPriority), maxPriority)
+	if priority == field.Priority {
+		return fmt.Sprintf("分野「%s」の優先度はすでに %d です。", field.Name, field.Priority), nil
+	}
+	if err := updateField(ctx, field, map[string]interface{}{"priority": priority}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("分野「%s」の優先度を %d から %d に変更しました。", field.Name, field.Priority, priority), nil
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 分野の検索で求める最低ストック数（min_stocks が未設定の場合）
+const defaultMinStocks = 30
+
+// 分野数の上限（ルームにもプランにも設定がない場合）
+const defaultFieldLimit = 20
+
+// fieldLimit はルームに登録できる分野数の上限を返す
+// ルームの field_limit、プランの上限（PLAN_FIELD_LIMITS、例: "free:20,pro:100"）、FIELD_LIMIT の順に使う
+func fieldLimit(room *roomSettings) int {
+	if room != nil {
+		if room.FieldLimit > 0 {
+			return room.FieldLimit
+		}
+		for _, entry := range strings.Split(os.Getenv("PLAN_FIELD_LIMITS"), ",") {
+			plan, limit, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok || room.Plan == "" || !strings.EqualFold(plan, room.Plan) {
+				continue
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(limit)); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return max(envInt("FIELD_LIMIT", defaultFieldLimit), 1)
+}
+
+// fieldInfo は fieldテーブルの1行
+type fieldInfo struct {
+	RoomID       string     `json:"room_id"`
+	Name         string     `json:"field_name"`
+	Priority     int        `json:"priority"`
+	MinStocks    int        `json:"min_stocks"`
+	EmptyStrikes int        `json:"empty_strikes"`
+	ExhaustedAt  *time.Time `json:"exhausted_at"`
+	// 分野の種類（keyword / user / org）と、フォローする分野で確認済みの最新の記事の投稿日時
+	Kind       string     `json:"kind"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	// ウォッチを始めた日時（未設定の場合はウォッチしていない）と、すぐに配信するストック数
+	WatchedAt      *time.Time `json:"watched_at"`
+	WatchMinStocks int        `json:"watch_min_stocks"`
+	// 分野を登録したメンバーのChatworkのアカウントID（未設定の場合はルーム全体の分野）
+	AccountID string `json:"account_id"`
+}
+
+// minStocks は分野の検索で求める最低ストック数を返す
+func (f fieldInfo) minStocks() int {
+	if f.MinStocks <= 0 {
+		return defaultMinStocks
+	}
+	return f.MinStocks
+}
+
+// notes は分野の一覧に添える状態（メンバーの分野・フォロー・ウォッチ中・記事が見つからない回数）を返す
+// accountIDのメンバーが登録した分野は「あなたの分野」とする
+func (f fieldInfo) notes(accountID string) []string {
+	var notes []string
+	if f.AccountID != "" {
+		if accountID != "" && f.AccountID == accountID {
+			notes = append(notes, "あなたの分野")
+		} else {
+			notes = append(notes, "メンバーの分野")
+		}
+	}
+	if f.isFollow() {
+		notes = append(notes, "フォロー")
+	}
+	if f.WatchedAt != nil {
+		notes = append(notes, "ウォッチ中")
+	}
+	switch {
+	case f.ExhaustedAt != nil:
+		notes = append(notes, "削除の確認中")
+	case f.EmptyStrikes > 0:
+		notes = append(notes, fmt.Sprintf("%d回続けて記事なし", f.EmptyStrikes))
+	}
+	return notes
+}
+
+// fetchFields は fieldテーブルから分野を取得する。filterには "room_id=eq.xxx" などを指定する
+// 列が未作成の環境でも動くよう、すべての列を取得する
+func fetchFields(ctx context.Context, filter string) ([]fieldInfo, error) {
+	path := "field?select=*"
+	if filter != "" {
+		path += "&" + filter
+	}
+	var fields []fieldInfo
+	if err := getRows(ctx, path, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// findRoomField はルームの分野を名前で探す（大文字・小文字は区別しない）。見つからなければnilを返す
+// accountIDを指定した場合はそのメンバーの分野を優先し、なければルーム全体の分野を探す
+func findRoomField(ctx context.Context, roomID, accountID, name string) (*fieldInfo, error) {
+	fields, err := fetchFields(ctx, "room_id=eq."+url.QueryEscape(roomID))
+	if err != nil {
+		return nil, err
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	var roomField *fieldInfo
+	for _, field := range fields {
+		if !strings.EqualFold(field.Name, name) {
+			continue
+		}
+		switch field.AccountID {
+		case accountID:
+			return &field, nil
+		case "":
+			roomField = &field
+		}
+	}
+	return roomField, nil
+}
+
+// fieldFilter は分野の1行を指定する条件を返す
+func fieldFilter(field fieldInfo) string {
+	filter := fmt.Sprintf("room_id=eq.%s&field_name=eq.%s",
+		url.QueryEscape(field.RoomID),
+		url.QueryEscape(field.Name))
+	if field.AccountID == "" {
+		return filter + "&account_id=is.null"
+	}
+	return filter + "&account_id=eq." + url.QueryEscape(field.AccountID)
+}
+
+// updateField は分野の列を更新する
+func updateField(ctx context.Context, field fieldInfo, values map[string]interface{}) error {
+	return patchRows(ctx, "field?"+fieldFilter(field), values)
+}
+
+// updateRoom は userテーブルのルームの列を更新する
+func updateRoom(ctx context.Context, roomID string, values map[string]interface{}) error {
+	return patchRows(ctx, "user?room_id=eq."+url.QueryEscape(roomID), values)
+}
+
+// getRows はpathに一致する行を取得してvに読み込む
+func getRows(ctx context.Context, path string, v interface{}) error {
+	req, err := newSupabaseRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := supabaseClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Supabaseエラー (%d): %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// patchRows はpathに一致する行の列を更新する
+func patchRows(ctx context.Context, path string, values map[string]interface{}) error {
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	req, err := newSupabaseRequest(ctx, "PATCH", path, bytes.NewReader(valuesJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	resp, err := supabaseClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Supabaseエラー (%d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// deleteField は分野を削除する
+func deleteField(ctx context.Context, field fieldInfo) error {
+	return deleteRows(ctx, "field?"+fieldFilter(field))
+}
+
+// deleteRows はpathに一致する行を削除する
+func deleteRows(ctx context.Context, path string) error {
+	req, err := newSupabaseRequest(ctx, "DELETE", path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := supabaseClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Supabaseエラー (%d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"qiita-search/models"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 分野の種類（fieldテーブルの kind）
+const (
+	fieldKindKeyword = "keyword" // タグ・タイトルの語（未設定の場合）
+	fieldKindUser    = "user"    // Qiitaのユーザーの新着記事
+	fieldKindOrg     = "org"     // Qiitaのorganizationの新着記事
+)
+
+// フォローした著者の新着記事として配信した場合の探し方
+const strategyFollow = "follow"
+
+// isFollow はユーザー・organizationをフォローする分野かどうかを返す
+func (f fieldInfo) isFollow() bool {
+	return f.Kind == fieldKindUser || f.Kind == fieldKindOrg
+}
+
+// followQuery はフォローする分野の新着記事を探すQiitaの検索クエリを返す
+// 分野名は "user:xxx" や "org:xxx" の形で保存されているため、そのまま検索の条件になる
+func (f fieldInfo) followQuery() string {
+	return f.Name
+}
+
+// QiitaのユーザーID・organization名に使える文字
+var qiitaIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parseFollow は "user:xxx"、"@xxx"、"org:xxx" の形の語を、フォローする種類とIDに分ける
+func parseFollow(word string) (string, string, bool) {
+	var kind, id string
+	lower := strings.ToLower(word)
+	switch {
+	case strings.HasPrefix(lower, "user:"):
+		kind, id = fieldKindUser, word[len("user:"):]
+	case strings.HasPrefix(lower, "org:"):
+		kind, id = fieldKindOrg, word[len("org:"):]
+	case strings.HasPrefix(word, "@"):
+		kind, id = fieldKindUser, word[1:]
+	default:
+		return "", "", false
+	}
+	id = strings.TrimSpace(id)
+	return kind, id, true
+}
+
+// prepareFollowField はフォローする分野を確認し、保存する分野名・表示用の名前・状態の文言を返す
+func prepareFollowField(ctx context.Context, kind, id string) (string, string, string, bool) {
+	label := kind + ":" + id
+	if !qiitaIDPattern.MatchString(id) {
+		return label, label, "QiitaのIDとして使えない文字が含まれています", false
+	}
+
+	switch kind {
+	case fieldKindUser:
+		user, err := fetchQiitaUser(ctx, id)
+		if err != nil {
+			log.Printf("ユーザー %s の確認に失敗しました: %v", id, err)
+			return label, label, "Qiitaでユーザーを確認できませんでした。時間をおいて再度お試しください", false
+		}
+		if user == nil {
+			return label, label, fmt.Sprintf("Qiitaに「%s」というユーザーが見つかりませんでした", id), false
+		}
+		name := "user:" + user.ID
+		return name, name, fmt.Sprintf("%sさんの新着記事を投稿され次第お届けします（記事%d件）", user.ID, user.ItemsCount), true
+	default:
+		// organizationはAPIで取得できないため、記事が検索できるかで確認する
+		found, err := hasQiitaItems(ctx, "org:"+id)
+		if err != nil {
+			log.Printf("organization %s の確認に失敗しました: %v", id, err)
+			return label, label, "Qiitaでorganizationを確認できませんでした。時間をおいて再度お試しください", false
+		}
+		if !found {
+			return label, label, fmt.Sprintf("Qiitaに「%s」というorganizationの記事が見つかりませんでした", id), false
+		}
+		return label, label, fmt.Sprintf("organization「%s」の新着記事を投稿され次第お届けします", id), true
+	}
+}
+
+// fetchQiitaUser は /api/v2/users/:id からユーザー情報を取得する。ユーザーが存在しない場合はnilを返す
+func fetchQiitaUser(ctx context.Context, id string) (*models.QiitaUser, error) {
+	var user models.QiitaUser
+	found, err := getQiita(ctx, "https://qiita.com/api/v2/users/"+url.PathEscape(id), &user)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// hasQiitaItems はクエリに一致する記事が1件以上あるかどうかを返す
+func hasQiitaItems(ctx context.Context, query string) (bool, error) {
+	var items []struct{}
+	_, err := getQiita(ctx, "https://qiita.com/api/v2/items?per_page=1&query="+url.QueryEscape(query), &items)
+	return len(items) > 0, err
+}
+
+// deliverFollowedArticles はフォローしている分野の、前回の確認より後に投稿された記事を古い順に配信する
+// 初回の確認の場合は最新の記事の投稿日時を記録するだけで、結果のRoomIDは空になる
+func (ac *ArticleController) deliverFollowedArticles(ctx context.Context, field fieldInfo, articles []models.Article, summaries map[string]string) (deliveryResult, error) {
+	type newArticle struct {
+		article   models.Article
+		createdAt time.Time
+	}
+	var latest time.Time
+	var fresh []newArticle
+	for _, article := range articles {
+		createdAt, err := time.Parse(time.RFC3339, article.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if createdAt.After(latest) {
+			latest = createdAt
+		}
+		if field.LastSeenAt != nil && createdAt.After(*field.LastSeenAt) {
+			fresh = append(fresh, newArticle{article: article, createdAt: createdAt})
+		}
+	}
+
+	if field.LastSeenAt == nil {
+		if latest.IsZero() {
+			latest = time.Now()
+		}
+		if err := updateField(ctx, field, map[string]interface{}{"last_seen_at": latest.UTC()}); err != nil {
+			log.Printf("分野 %s の確認日時の記録に失敗しました: %v", field.Name, err)
+		}
+		return deliveryResult{}, nil
+	}
+
+	result := deliveryResult{RoomID: field.RoomID, Kind: strategyFollow}
+	if len(fresh) == 0 {
+		return result, errNoNewArticle
+	}
+	sort.Slice(fresh, func(i, j int) bool {
+		return fresh[i].createdAt.Before(fresh[j].createdAt)
+	})
+
+	for _, f := range fresh {
+		article := f.article
+		delivered, err := isDelivered(ctx, field.RoomID, article.URL)
+		if err != nil {
+			return result, withOutcome(outcomeUpstreamError, err)
+		}
+
+		if !delivered {
+			// 新着をすぐに届けることを優先し、要約できなくても記事は配信する
+			summary, ok := summaries[article.URL]
+			if !ok {
+				if err := article.Summarize(ctx); err != nil {
+					log.Printf("記事 %s の要約に失敗しました: %v", article.URL, err)
+					result.SummaryFailures++
+				}
+				summary = article.Summary
+				summaries[article.URL] = summary
+			}
+			article.Summary = summary
+
+			p := pickedArticle{article: article, field: field.Name, strategy: strategyFollow, accountID: field.AccountID}
+			if err := postSingleArticle(ctx, field.RoomID, p); err != nil {
+				return result, withOutcome(outcomePostError, err)
+			}
+			result.Articles = append(result.Articles, deliveredArticle{URL: article.URL, Field: field.Name, Strategy: strategyFollow})
+			if err := recordHistory(ctx, field.RoomID, article.URL); err != nil {
+				return result, withOutcome(outcomeUpstreamError, err)
+			}
+		}
+
+		// 配信できた記事までを確認済みにし、途中で失敗した記事は次回もう一度送る
+		if err := updateField(ctx, field, map[string]interface{}{"last_seen_at": f.createdAt.UTC()}); err != nil {
+			return result, withOutcome(outcomeUpstreamError, err)
+		}
+	}
+
+	if len(result.Articles) == 0 {
+		return result, errNoNewArticle
+	}
+	return result, nil
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// notifier は運用者への通知先
+type notifier interface {
+	Notify(ctx context.Context, title, body string) error
+}
+
+// chatworkNotifier はChatworkのルームに通知する
+type chatworkNotifier struct {
+	roomID string
+}
+
+func (n chatworkNotifier) Notify(ctx context.Context, title, body string) error {
+	_, err := postChatworkMessage(ctx, n.roomID, fmt.Sprintf("[info][title]%s[/title]%s[/info]", title, body))
+	return err
+}
+
+// webhookNotifier は {"text": "..."} 形式のJSONをWebhookに送る（Slackの Incoming Webhook など）
+type webhookNotifier struct {
+	url string
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, title, body string) error {
+	payload, err := json.Marshal(map[string]string{"text": title + "\n" + body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhookエラー (%d)", resp.StatusCode)
+	}
+	return nil
+}
+
+// newAdminNotifiers は環境変数から管理者への通知先を組み立てる
+// ADMIN_ROOM_ID（Chatworkのルーム）と ADMIN_WEBHOOK_URL のどちらも未設定なら通知しない
+func newAdminNotifiers() []notifier {
+	var notifiers []notifier
+	if roomID := os.Getenv("ADMIN_ROOM_ID"); roomID != "" {
+		notifiers = append(notifiers, chatworkNotifier{roomID: roomID})
+	}
+	if webhookURL := os.Getenv("ADMIN_WEBHOOK_URL"); webhookURL != "" {
+		notifiers = append(notifiers, webhookNotifier{url: webhookURL})
+	}
+	return notifiers
+}
+
+// reportRun は配信処理の結果をまとめて管理者に通知する
+func (ac *ArticleController) reportRun(ctx context.Context, run deliveryRun) {
+	if len(ac.adminNotifiers) == 0 {
+		return
+	}
+
+	title, body := summarizeRun(run)
+	for _, n := range ac.adminNotifiers {
+		if err := n.Notify(ctx, title, body); err != nil {
+			log.Printf("管理者への通知に失敗しました: %v", err)
+		}
+	}
+}
+
+// summarizeRun は配信処理の結果を通知用の文面にする
+func summarizeRun(run deliveryRun) (string, string) {
+	failures, summaryFailures := 0, 0
+	var failureLines []string
+	for _, result := range run.Results {
+		summaryFailures += result.SummaryFailures
+		if result.Outcome.isFailure() {
+			failures++
+			failureLines = append(failureLines, fmt.Sprintf("・ルーム %s（%s）: %s（%s）", result.RoomID, result.Kind, result.Outcome, result.Error))
+		}
+	}
+	sort.Strings(failureLines)
+
+	title := "配信レポート"
+	if failures > 0 {
+		title = fmt.Sprintf("配信レポート（失敗 %d件）", failures)
+	}
+
+	lines := []string{
+		fmt.Sprintf("配信: %d 件", run.Outcomes[outcomeFound]),
+		fmt.Sprintf("記事なし: %d 件", run.Outcomes[outcomeExhausted]),
+		fmt.Sprintf("一時停止中: %d ルーム", run.Outcomes[outcomePaused]),
+		fmt.Sprintf("後回し: %d ルーム", len(run.Deferred)),
+	}
+
+	var errorCounts []string
+	for _, outcome := range []deliveryOutcome{outcomeUpstreamError, outcomeRateLimited, outcomeSummarizerError, outcomePostError} {
+		if n := run.Outcomes[outcome]; n > 0 {
+			errorCounts = append(errorCounts, fmt.Sprintf("%s %d", outcome, n))
+		}
+	}
+	if len(errorCounts) > 0 {
+		lines = append(lines, "エラー: "+strings.Join(errorCounts, "、"))
+	} else {
+		lines = append(lines, "エラー: なし")
+	}
+	// 一部の記事だけ要約に失敗した場合やフォロー・ウォッチの記事も含め、要約に失敗した記事の数を数える
+	lines = append(lines, fmt.Sprintf("Geminiの要約の失敗: %d 記事", summaryFailures))
+
+	quota := fmt.Sprintf("Qiita API: 今回 %d リクエスト", run.Quota.Requests)
+	if run.Quota.Limit > 0 {
+		quota += fmt.Sprintf("、残り %d / %d（リセット %s）",
+			run.Quota.Remaining, run.Quota.Limit, run.Quota.ResetAt.In(jst).Format("15:04"))
+	}
+	lines = append(lines, quota)
+	lines = append(lines, fmt.Sprintf("Qiitaキャッシュ: ヒット %d / 再検証 %d / 取得 %d",
+		run.Cache.Hits, run.Cache.Revalidated, run.Cache.Misses))
+
+	if len(failureLines) > 0 {
+		lines = append(lines, "", "失敗したルーム:")
+		lines = append(lines, failureLines...)
+	}
+	return title, strings.Join(lines, "\n")
+}
+
+// 日本時間
+var jst = time.FixedZone("JST", 9*60*60)
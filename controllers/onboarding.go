@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// welcomeMessage はルームを登録したときに送る案内
+const welcomeMessage = "[info][title]Qiitaの記事の配信を始めました[/title]" +
+	"このルームに興味のある分野（例: Go, Rust, \"cursor rules\"）を送ると、分野に合った人気の記事を毎日お届けします。\n" +
+	"・複数の分野は「,」や「、」、改行で区切って送れます\n" +
+	"・Qiitaのユーザーは user:ID、organizationは org:名前 でフォローできます\n" +
+	"・配信をやめる場合は /leave を送ってください[/info]"
+
+// isJoinRequest は未登録のルームからの参加の依頼（/join、またはボットへのメンション）かどうかを返す
+// ボットへのメンションは CHATWORK_BOT_ACCOUNT_ID が設定されている場合のみ受け付ける
+func isJoinRequest(message string) bool {
+	name, _, _ := strings.Cut(strings.TrimSpace(message), " ")
+	if strings.EqualFold(name, "/join") {
+		return true
+	}
+	botID := os.Getenv("CHATWORK_BOT_ACCOUNT_ID")
+	return botID != "" && strings.Contains(message, "[To:"+botID+"]")
+}
+
+// stripBotMention はメッセージの先頭にあるボットへのメンション（[To:ボットのID]と表示名の行）を取り除く
+// メンションで参加したルームでも、続けて送ったコマンドや分野をそのまま受け付けるため
+func stripBotMention(message string) string {
+	botID := os.Getenv("CHATWORK_BOT_ACCOUNT_ID")
+	if botID == "" {
+		return message
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(message), "[To:"+botID+"]")
+	if !ok {
+		return message
+	}
+	// Chatworkはメンションの後に宛先の表示名を続けるため、改行までを宛先として扱う
+	if _, body, found := strings.Cut(rest, "\n"); found {
+		return strings.TrimSpace(body)
+	}
+	return strings.TrimSpace(rest)
+}
+
+// fetchRoom は userテーブルからルームを取得する。登録されていなければnilを返す
+func fetchRoom(ctx context.Context, roomID string) (*roomSettings, error) {
+	var rooms []roomSettings
+	if err := getRows(ctx, "user?select=*&room_id=eq."+url.QueryEscape(roomID), &rooms); err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return nil, nil
+	}
+	return &rooms[0], nil
+}
+
+// joinRoom はルームを userテーブルに登録し、ルームに送る案内を返す
+func (uc *UserController) joinRoom(ctx context.Context, roomID string) string {
+	userJSON, err := json.Marshal(map[string]interface{}{"room_id": roomID})
+	if err != nil {
+		return "ルームの登録に失敗しました"
+	}
+	req, err := newSupabaseRequest(ctx, "POST", "user", bytes.NewReader(userJSON))
+	if err != nil {
+		return "ルームの登録に失敗しました"
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	resp, err := supabaseClient.Do(req)
+	if err != nil {
+		log.Printf("ルーム %s の登録に失敗しました: %v", roomID, err)
+		return "ルームの登録に失敗しました。時間をおいて再度お試しください"
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return "このルームはすでに登録されています。分野を送って登録してください"
+	}
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("ルーム %s の登録に失敗しました (%d): %s", roomID, resp.StatusCode, string(body))
+		return "ルームの登録に失敗しました。時間をおいて再度お試しください"
+	}
+	return welcomeMessage
+}
+
+// leaveCommand は /leave（解除の確認）と /leave confirm（解除）を実行する
+// 確認から LEAVE_CONFIRM_TIMEOUT（既定は10分）以内に /leave confirm が送られた場合だけ、
+// ルームと、その分野・配信履歴を削除する
+func (uc *UserController) leaveCommand(ctx context.Context, roomID, args string) string {
+	timeout := envDuration("LEAVE_CONFIRM_TIMEOUT", 10*time.Minute)
+
+	room, err := fetchRoom(ctx, roomID)
+	if err != nil {
+		log.Printf("ルーム %s の取得に失敗しました: %v", roomID, err)
+		return "ルームの確認に失敗しました。時間をおいて再度お試しください"
+	}
+	if room == nil {
+		return "このルームは登録されていません"
+	}
+
+	if !strings.EqualFold(args, "confirm") {
+		if err := updateRoom(ctx, roomID, map[string]interface{}{"leave_requested_at": time.Now().UTC()}); err != nil {
+			log.Printf("ルーム %s の更新に失敗しました: %v", roomID, err)
+			return "解除の受付に失敗しました。時間をおいて再度お試しください"
+		}
+		return fmt.Sprintf("[info][title]配信の解除の確認[/title]"+
+			"このルームへの配信をやめ、登録した分野・配信履歴・ブロックをすべて削除します。\n"+
+			"よろしければ %s以内に /leave confirm を送ってください。[/info]", formatDuration(timeout))
+	}
+
+	if room.LeaveRequestedAt == nil || time.Since(*room.LeaveRequestedAt) > timeout {
+		return "先に /leave を送ってから、/leave confirm を送ってください"
+	}
+
+	// 分野・配信履歴・ブロックを先に削除し、途中で失敗してもルームが残って再度実行できるようにする
+	for _, path := range []string{
+		"field?room_id=eq." + url.QueryEscape(roomID),
+		"article_history?room_id=eq." + url.QueryEscape(roomID),
+		"room_block?room_id=eq." + url.QueryEscape(roomID),
+		"user?room_id=eq." + url.QueryEscape(roomID),
+	} {
+		if err := deleteRows(ctx, path); err != nil {
+			log.Printf("ルーム %s の削除に失敗しました（%s）: %v", roomID, path, err)
+			return "解除に失敗しました。時間をおいて再度お試しください"
+		}
+	}
+	return "このルームへの配信をやめました。また使う場合は /join を送ってください"
+}
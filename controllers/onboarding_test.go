@@ -0,0 +1,59 @@
+package controllers
+
+import "testing"
+
+func TestStripBotMention(t *testing.T) {
+	t.Setenv("CHATWORK_BOT_ACCOUNT_ID", "999")
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+		command bool
+	}{
+		{"メンションの行とコマンド", "[To:999]Qiitaボット\n/pause 7d", "/pause 7d", true},
+		{"メンションの後に空白とコマンド", "  [To:999]Qiitaボットさん\n  /list", "/list", true},
+		{"同じ行に分野", "[To:999] Go, Rust", "Go, Rust", false},
+		{"メンションの行と複数行の分野", "[To:999]Qiitaボット\nGo\nRust", "Go\nRust", false},
+		{"メンションだけ", "[To:999]Qiitaボット", "Qiitaボット", false},
+		{"ほかのメンバーへのメンションは残す", "[To:123]山田さん\n/pause 7d", "[To:123]山田さん\n/pause 7d", false},
+		{"メンションなし", "/pause 7d", "/pause 7d", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stripBotMention(tt.message)
+			if got != tt.want {
+				t.Errorf("stripBotMention(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+			if isCommand(got) != tt.command {
+				t.Errorf("isCommand(%q) = %v, want %v", got, !tt.command, tt.command)
+			}
+		})
+	}
+}
+
+func TestStripBotMentionWithoutBotID(t *testing.T) {
+	t.Setenv("CHATWORK_BOT_ACCOUNT_ID", "")
+
+	message := "[To:999]Qiitaボット\n/pause 7d"
+	if got := stripBotMention(message); got != message {
+		t.Errorf("stripBotMention(%q) = %q, want unchanged", message, got)
+	}
+}
+
+func TestIsJoinRequest(t *testing.T) {
+	t.Setenv("CHATWORK_BOT_ACCOUNT_ID", "999")
+
+	tests := map[string]bool{
+		"/join":                  true,
+		" /JOIN please":          true,
+		"[To:999]Qiitaボット\nよろしく": true,
+		"[To:123]山田さん":           false,
+		"Go, Rust":               false,
+	}
+	for message, want := range tests {
+		if got := isJoinRequest(message); got != want {
+			t.Errorf("isJoinRequest(%q) = %v, want %v", message, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paused はルームの配信が一時停止中かどうかを返す
+func (r roomSettings) paused(now time.Time) bool {
+	return r.PausedUntil != nil && now.Before(*r.PausedUntil)
+}
+
+// parsePauseUntil は /pause の期間（"7d"、"2w"、"12h"、"2026-11-03" など）から、配信を再開する日時を返す
+// 日付を指定した場合は、その日（日本時間）から再開する
+func parsePauseUntil(spec string, now time.Time) (time.Time, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" {
+		return time.Time{}, fmt.Errorf("期間を指定してください（例: /pause 7d、/pause 2w、/pause 2026-11-03）")
+	}
+
+	if date, err := time.ParseInLocation("2006-01-02", spec, jst); err == nil {
+		if !date.After(now) {
+			return time.Time{}, fmt.Errorf("再開する日には明日以降の日付を指定してください")
+		}
+		return date, nil
+	}
+
+	units := map[string]time.Duration{
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	unit, ok := units[spec[len(spec)-1:]]
+	if !ok {
+		return time.Time{}, fmt.Errorf("期間 %q を解釈できませんでした（例: 12h、7d、2w）", spec)
+	}
+	n, err := strconv.Atoi(spec[:len(spec)-1])
+	if err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("期間 %q を解釈できませんでした（例: 12h、7d、2w）", spec)
+	}
+	// 掛け算の前に上限と比べ、大きな数でDurationがあふれないようにする
+	if time.Duration(n) > 366*24*time.Hour/unit {
+		return time.Time{}, fmt.Errorf("一時停止できるのは1年までです")
+	}
+	return now.Add(time.Duration(n) * unit), nil
+}
+
+func (uc *UserController) pauseCommand(ctx context.Context, roomID, args string) string {
+	until, err := parsePauseUntil(args, time.Now())
+	if err != nil {
+		return err.Error()
+	}
+	if err := updateRoom(ctx, roomID, map[string]interface{}{"paused_until": until.UTC()}); err != nil {
+		log.Printf("ルーム %s の更新に失敗しました: %v", roomID, err)
+		return "一時停止に失敗しました。時間をおいて再度お試しください"
+	}
+	return fmt.Sprintf("%s まで配信を一時停止します。早めに再開する場合は /resume を送ってください",
+		until.In(jst).Format("2006/01/02 15:04"))
+}
+
+func (uc *UserController) resumeCommand(ctx context.Context, roomID string) string {
+	room, err := fetchRoom(ctx, roomID)
+	if err != nil {
+		log.Printf("ルーム %s の取得に失敗しました: %v", roomID, err)
+		return "ルームの確認に失敗しました。時間をおいて再度お試しください"
+	}
+	if room == nil || !room.paused(time.Now()) {
+		return "配信は一時停止していません"
+	}
+	if err := updateRoom(ctx, roomID, map[string]interface{}{"paused_until": nil}); err != nil {
+		log.Printf("ルーム %s の更新に失敗しました: %v", roomID, err)
+		return "再開に失敗しました。時間をおいて再度お試しください"
+	}
+	return "配信を再開しました"
+}
+
+// fetchPausedRooms は一時停止中のルームIDを返す
+func fetchPausedRooms(ctx context.Context) (map[string]bool, error) {
+	var rooms []roomSettings
+	if err := getRows(ctx, "user?select=room_id&paused_until=gt."+url.QueryEscape(time.Now().UTC().Format(time.RFC3339)), &rooms); err != nil {
+		return nil, err
+	}
+	paused := make(map[string]bool, len(rooms))
+	for _, room := range rooms {
+		paused[room.RoomID] = true
+	}
+	return paused, nil
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePauseUntil(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, jst)
+	tests := []struct {
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{spec: "12h", want: now.Add(12 * time.Hour)},
+		{spec: "7d", want: now.AddDate(0, 0, 7)},
+		{spec: " 2W ", want: now.AddDate(0, 0, 14)},
+		{spec: "366d", want: now.AddDate(0, 0, 366)},
+		{spec: "2026-11-03", want: time.Date(2026, 11, 3, 0, 0, 0, 0, jst)},
+		{spec: "", wantErr: true},
+		{spec: "7", wantErr: true},
+		{spec: "0d", wantErr: true},
+		{spec: "-1d", wantErr: true},
+		{spec: "1y", wantErr: true},
+		{spec: "367d", wantErr: true},
+		{spec: "8785h", wantErr: true},
+		{spec: "53w", wantErr: true},
+		{spec: "200000w", wantErr: true},
+		{spec: "9223372036854775807h", wantErr: true},
+		{spec: "2026-10-18", wantErr: true},
+		{spec: "2026-10-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parsePauseUntil(tt.spec, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsePauseUntil(%q) = %v, want error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePauseUntil(%q): %v", tt.spec, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parsePauseUntil(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"qiita-search/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pollGroup は同じクエリで確認できる分野のまとまり
+type pollGroup struct {
+	query  string
+	fields []fieldInfo
+}
+
+// groupByQuery は分野をクエリごとにまとめる。同じクエリの分野が複数のルームにあっても1回だけ検索するため
+func groupByQuery(fields []fieldInfo, query func(fieldInfo) string) []pollGroup {
+	index := make(map[string]int)
+	var groups []pollGroup
+	for _, field := range fields {
+		q := query(field)
+		i, ok := index[q]
+		if !ok {
+			i = len(groups)
+			index[q] = i
+			groups = append(groups, pollGroup{query: q})
+		}
+		groups[i].fields = append(groups[i].fields, field)
+	}
+	return groups
+}
+
+// activeFields は一時停止中のルームの分野を除く
+func activeFields(fields []fieldInfo, paused map[string]bool) []fieldInfo {
+	var active []fieldInfo
+	for _, field := range fields {
+		if !paused[field.RoomID] {
+			active = append(active, field)
+		}
+	}
+	return active
+}
+
+// Poll はフォローしているユーザー・organizationの新着記事と、ウォッチしている分野で人気が出始めた記事を確認し、
+// 見つかった記事をすぐにルームへ配信するハンドラー。cronなどから短い間隔（例: 10分ごと）で呼び出す
+func (ac *ArticleController) Poll(c echo.Context) error {
+	ctx := context.WithoutCancel(c.Request().Context())
+
+	followed, err := fetchFields(ctx, "kind=in.(user,org)")
+	if err != nil {
+		log.Printf("フォローしている分野の取得に失敗しました: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "フォローしている分野の取得に失敗しました",
+		})
+	}
+	watched, err := fetchFields(ctx, "watched_at=not.is.null")
+	if err != nil {
+		log.Printf("ウォッチしている分野の取得に失敗しました: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "ウォッチしている分野の取得に失敗しました",
+		})
+	}
+
+	// 一時停止中のルームには配信しない
+	paused, err := fetchPausedRooms(ctx)
+	if err != nil {
+		log.Printf("一時停止中のルームの取得に失敗しました: %v", err)
+	}
+	followed = activeFields(followed, paused)
+	watched = activeFields(watched, paused)
+
+	run := deliveryRun{Outcomes: make(map[deliveryOutcome]int)}
+	startQuota, _ := qiitaRateLimiter.Quota()
+	startCache := qiitaCache.Stats()
+
+	// 同じ記事を複数のルームに送る場合に、要約を使い回す
+	summaries := make(map[string]string)
+	ac.pollGroups(ctx, &run, strategyFollow, groupByQuery(followed, fieldInfo.followQuery),
+		func(ctx context.Context, field fieldInfo, articles []models.Article) (deliveryResult, error) {
+			return ac.deliverFollowedArticles(ctx, field, articles, summaries)
+		})
+	var watchable []fieldInfo
+	for _, field := range watched {
+		if !field.isFollow() {
+			watchable = append(watchable, field)
+		}
+	}
+	ac.pollGroups(ctx, &run, strategyWatch, groupByQuery(watchable, func(field fieldInfo) string { return ac.watchQuery(ctx, field) }),
+		func(ctx context.Context, field fieldInfo, articles []models.Article) (deliveryResult, error) {
+			return ac.deliverWatchedArticles(ctx, field, articles, summaries)
+		})
+
+	run.Quota, _ = qiitaRateLimiter.Quota()
+	run.Quota.Requests -= startQuota.Requests
+	run.Cache = qiitaCache.Stats()
+	run.Cache.Hits -= startCache.Hits
+	run.Cache.Revalidated -= startCache.Revalidated
+	run.Cache.Misses -= startCache.Misses
+
+	// 短い間隔で呼び出されるため、失敗があった場合だけ管理者に知らせる
+	for _, result := range run.Results {
+		if result.Outcome.isFailure() {
+			ac.reportRun(ctx, run)
+			break
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "新着記事の確認が完了しました",
+		"result":  run,
+	})
+}
+
+// pollGroups はクエリごとに1ページ目の記事を検索し、deliverで分野ごとに配信する
+// deliverが空のRoomIDの結果を返した場合は、配信の対象外として結果に含めない
+func (ac *ArticleController) pollGroups(ctx context.Context, run *deliveryRun, kind string, groups []pollGroup,
+	deliver func(ctx context.Context, field fieldInfo, articles []models.Article) (deliveryResult, error)) {
+	for i, group := range groups {
+		if !qiitaRateLimiter.waitForQuota(ac.quotaReserve, ac.ratePauseMax, ctx.Done()) {
+			for _, rest := range groups[i:] {
+				for _, field := range rest.fields {
+					run.Deferred = append(run.Deferred, field.RoomID)
+				}
+			}
+			log.Printf("Qiita APIの残りリクエスト数が不足しているため、%d 件の確認（%s）を後回しにします", len(groups)-i, kind)
+			return
+		}
+
+		// 新着を見逃さないよう、キャッシュを使わずに検索する
+		queryCtx, cancel := context.WithTimeout(withFreshQiita(ctx), ac.roomTimeout)
+		articles, err := ac.searchArticles(queryCtx, qiitaSearchURL(1, group.query))
+		cancel()
+		if err != nil {
+			outcome := classifyOutcome(withOutcome(outcomeUpstreamError, err))
+			for _, field := range group.fields {
+				run.Results = append(run.Results, deliveryResult{RoomID: field.RoomID, Kind: kind, Outcome: outcome, Error: err.Error()})
+				run.Outcomes[outcome]++
+			}
+			log.Printf("%s の記事の確認に失敗しました: %v", group.query, err)
+			continue
+		}
+
+		for _, field := range group.fields {
+			// 要約・投稿に時間がかかっても同じクエリのほかの分野に影響しないよう、分野ごとに期限を設ける
+			fieldCtx, cancel := context.WithTimeout(ctx, ac.roomTimeout)
+			result, err := deliver(fieldCtx, field, articles)
+			cancel()
+			if result.RoomID == "" {
+				continue
+			}
+			result.Outcome = classifyOutcome(err)
+			if err != nil {
+				result.Error = err.Error()
+				log.Printf("ルーム %s への %s の記事の配信に失敗しました（%s）: %v", field.RoomID, group.query, result.Outcome, err)
+			}
+			run.Results = append(run.Results, result)
+			run.Outcomes[result.Outcome]++
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errQiitaRateLimited はQiita APIの残りリクエスト数が尽きていることを表す
+var errQiitaRateLimited = errors.New("Qiita APIのレート制限に達しました")
+
+// getQiita はQiita APIにGETリクエストを送り、レスポンスをvに読み込む
+// 見つからない（404）場合はfalseを返す
+func getQiita(ctx context.Context, apiURL string, v interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if qiitaToken := os.Getenv("QIITA_ACCESS_TOKEN"); qiitaToken != "" {
+		req.Header.Set("Authorization", "Bearer "+qiitaToken)
+	}
+
+	resp, err := qiitaClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Qiita APIエラー (%d)", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// qiitaQuota はQiita APIのレート制限の状態
+type qiitaQuota struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+	Requests  int       `json:"requests"`
+}
+
+// qiitaTransport はQiitaのRate-Remaining/Rate-Resetヘッダーを記録し、
+// 429と5xxを指数バックオフ（ジッター付き）でリトライする
+type qiitaTransport struct {
+	base       http.RoundTripper
+	timeout    time.Duration // 1回のリクエストのタイムアウト（0の場合は設定しない）
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	resetAt   time.Time
+	requests  int
+}
+
+func (t *qiitaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 残り回数が0と分かっている場合はリセットまでリクエストを送らない
+	if quota, known := t.Quota(); known && quota.Remaining <= 0 && time.Now().Before(quota.ResetAt) {
+		return nil, fmt.Errorf("%w（リセット: %s）", errQiitaRateLimited, quota.ResetAt.Format(time.RFC3339))
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("リクエストボディを再送できません")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.attempt(req)
+		t.record(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= t.maxRetries {
+			return resp, nil
+		}
+
+		delay := t.backoff(attempt, resp)
+		resp.Body.Close()
+		log.Printf("Qiita APIがステータス %d を返しました。%s 後にリトライします（%d/%d）",
+			resp.StatusCode, delay.Round(time.Millisecond), attempt+1, t.maxRetries)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt は1回分のリクエストを送る。タイムアウトはレスポンスボディを閉じるまで有効にする
+func (t *qiitaTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose はボディを閉じたときにリクエストのコンテキストを解放する
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// backoff は次のリトライまでの待ち時間を返す
+// Retry-Afterヘッダーがあればそれを優先し、なければフルジッターの指数バックオフを使う
+func (t *qiitaTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, t.maxDelay)
+	}
+	// QIITA_MAX_RETRIES が大きくてもシフトであふれないよう、上限を超えたら maxDelay にする
+	ceiling := t.maxDelay
+	if attempt < 32 && t.baseDelay > 0 && t.baseDelay <= t.maxDelay>>attempt {
+		ceiling = t.baseDelay << attempt
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// record はレスポンスヘッダーからレート制限の状態を読み取る
+func (t *qiitaTransport) record(resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests++
+	if resp == nil {
+		return
+	}
+
+	remaining, err := strconv.Atoi(resp.Header.Get("Rate-Remaining"))
+	if err != nil {
+		return
+	}
+	t.known = true
+	t.remaining = remaining
+	if limit, err := strconv.Atoi(resp.Header.Get("Rate-Limit")); err == nil {
+		t.limit = limit
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("Rate-Reset"), 10, 64); err == nil {
+		t.resetAt = time.Unix(reset, 0)
+	}
+}
+
+// Quota は現在のレート制限の状態を返す。ヘッダーをまだ受け取っていない場合はfalseを返す
+func (t *qiitaTransport) Quota() (qiitaQuota, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	quota := qiitaQuota{
+		Limit:     t.limit,
+		Remaining: t.remaining,
+		ResetAt:   t.resetAt,
+		Requests:  t.requests,
+	}
+	// リセット時刻を過ぎていれば上限まで回復している
+	if t.known && !t.resetAt.IsZero() && time.Now().After(t.resetAt) {
+		quota.Remaining = t.limit
+	}
+	return quota, t.known
+}
+
+// waitForQuota は残りリクエスト数がreserveを下回っている場合、
+// リセットまでの時間がmaxPause以内なら待機する。待てない場合はfalseを返す
+func (t *qiitaTransport) waitForQuota(reserve int, maxPause time.Duration, done <-chan struct{}) bool {
+	quota, known := t.Quota()
+	if !known || quota.Remaining >= reserve {
+		return true
+	}
+
+	wait := time.Until(quota.ResetAt)
+	if wait > maxPause {
+		return false
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	log.Printf("Qiita APIの残りリクエスト数が %d 回のため、リセットまで %s 待機します", quota.Remaining, wait.Round(time.Second))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
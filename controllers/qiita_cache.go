@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedResponse はキャッシュしたQiita APIのレスポンス
+type cachedResponse struct {
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	ETag     string      `json:"etag"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// qiitaCacheStats はキャッシュの利用状況
+type qiitaCacheStats struct {
+	Hits          int `json:"hits"`
+	Revalidated   int `json:"revalidated"`
+	Misses        int `json:"misses"`
+	StoredEntries int `json:"stored_entries"`
+}
+
+// freshQiitaKey はQiita APIの最新のレスポンスが必要なことを示すcontextのキー
+type freshQiitaKey struct{}
+
+// withFreshQiita はQiita APIへのリクエストでキャッシュを使わないcontextを返す
+// 新着の確認や記事の記録など、キャッシュの古いレスポンスでは困る処理で使う
+func withFreshQiita(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshQiitaKey{}, true)
+}
+
+// wantsFreshQiita はctxがキャッシュを使わないリクエスト用かどうかを返す
+func wantsFreshQiita(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshQiitaKey{}).(bool)
+	return fresh
+}
+
+// qiitaCacheTransport はQiita APIのGETレスポンスをTTL付きでキャッシュする
+// TTLを過ぎたエントリにETagがあればIf-None-Matchで再検証し、304ならキャッシュを使い続ける
+// リクエストに Cache-Control: no-cache が付いている場合は、TTL内でも必ずQiitaに確認する
+// dirが指定されている場合はファイルにも保存し、再起動後も利用する
+type qiitaCacheTransport struct {
+	base       http.RoundTripper
+	ttl        time.Duration
+	maxEntries int
+	dir        string
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+	stats   qiitaCacheStats
+}
+
+func (t *qiitaCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || t.ttl <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	entry := t.lookup(key)
+	noCache := strings.Contains(req.Header.Get("Cache-Control"), "no-cache")
+	if entry != nil && !noCache && time.Since(entry.StoredAt) < t.ttl {
+		t.count(func(s *qiitaCacheStats) { s.Hits++ })
+		return entry.response(req), nil
+	}
+
+	if entry != nil && entry.ETag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if errors.Is(err, errQiitaRateLimited) && entry != nil && !noCache {
+		// レート制限中は期限切れのキャッシュでも使う
+		t.count(func(s *qiitaCacheStats) { s.Hits++ })
+		return entry.response(req), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		refreshed := *entry
+		refreshed.StoredAt = time.Now()
+		t.store(key, &refreshed)
+		t.count(func(s *qiitaCacheStats) { s.Revalidated++ })
+		return refreshed.response(req), nil
+	}
+
+	t.count(func(s *qiitaCacheStats) { s.Misses++ })
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.store(key, &cachedResponse{
+		URL:      key,
+		Header:   resp.Header.Clone(),
+		Body:     body,
+		ETag:     resp.Header.Get("ETag"),
+		StoredAt: time.Now(),
+	})
+	return resp, nil
+}
+
+// response はキャッシュから http.Response を組み立てる
+func (e *cachedResponse) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func (t *qiitaCacheTransport) lookup(key string) *cachedResponse {
+	t.mu.Lock()
+	entry, ok := t.entries[key]
+	t.mu.Unlock()
+	if ok || t.dir == "" {
+		return entry
+	}
+
+	// メモリになければファイルから読み込む
+	data, err := os.ReadFile(t.path(key))
+	if err != nil {
+		return nil
+	}
+	entry = &cachedResponse{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.URL != key {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.entries[key] = entry
+	t.mu.Unlock()
+	return entry
+}
+
+func (t *qiitaCacheTransport) store(key string, entry *cachedResponse) {
+	t.mu.Lock()
+	t.entries[key] = entry
+	if t.maxEntries > 0 && len(t.entries) > t.maxEntries {
+		t.evictOldest()
+	}
+	t.mu.Unlock()
+
+	if t.dir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// 書き込み途中のファイルを読まないよう、一時ファイルからリネームする
+	tmp, err := os.CreateTemp(t.dir, "qiita-*.tmp")
+	if err != nil {
+		log.Printf("Qiitaキャッシュの保存に失敗しました: %v", err)
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Qiitaキャッシュの保存に失敗しました: %v", errors.Join(writeErr, closeErr))
+		return
+	}
+	if err := os.Rename(tmp.Name(), t.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Qiitaキャッシュの保存に失敗しました: %v", err)
+	}
+}
+
+// evictOldest は最も古いエントリをメモリから取り除く（呼び出し側でロックを取得すること）
+func (t *qiitaCacheTransport) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range t.entries {
+		if oldestKey == "" || entry.StoredAt.Before(oldest) {
+			oldestKey = key
+			oldest = entry.StoredAt
+		}
+	}
+	delete(t.entries, oldestKey)
+}
+
+func (t *qiitaCacheTransport) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (t *qiitaCacheTransport) count(update func(*qiitaCacheStats)) {
+	t.mu.Lock()
+	update(&t.stats)
+	t.mu.Unlock()
+}
+
+// Stats は現在までのキャッシュの利用状況を返す
+func (t *qiitaCacheTransport) Stats() qiitaCacheStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.stats
+	stats.StoredEntries = len(t.entries)
+	return stats
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc は関数を http.RoundTripper として使う
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestQiitaCache はメモリのみのキャッシュを作る
+func newTestQiitaCache(base http.RoundTripper, ttl time.Duration) *qiitaCacheTransport {
+	return &qiitaCacheTransport{base: base, ttl: ttl, entries: make(map[string]*cachedResponse)}
+}
+
+// qiitaCacheServer はETag付きでbodyを返し、If-None-Matchが一致すれば304を返すテスト用のサーバー
+// callsにはリクエストの回数、notModifiedには304を返した回数を記録する
+func qiitaCacheServer(t *testing.T, body string, calls, notModified *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// getThroughCache はキャッシュ経由でGETし、ステータスとボディを返す
+func getThroughCache(t *testing.T, cache *qiitaCacheTransport, url string, header http.Header) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := cache.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("リクエストに失敗しました: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestQiitaCacheTransport(t *testing.T) {
+	noCache := http.Header{"Cache-Control": {"no-cache"}}
+	tests := []struct {
+		name            string
+		ttl             time.Duration
+		age             time.Duration // 2回目のリクエストの前にキャッシュを古くする時間
+		header          http.Header   // 2回目のリクエストのヘッダー
+		wantCalls       int32
+		wantNotModified int32
+		wantStats       qiitaCacheStats
+	}{
+		{"TTL内はキャッシュを使う", time.Hour, 0, nil, 1, 0,
+			qiitaCacheStats{Hits: 1, Misses: 1, StoredEntries: 1}},
+		{"TTLを過ぎたらETagで再検証する", time.Hour, 2 * time.Hour, nil, 2, 1,
+			qiitaCacheStats{Revalidated: 1, Misses: 1, StoredEntries: 1}},
+		{"no-cacheはTTL内でも再検証する", time.Hour, 0, noCache, 2, 1,
+			qiitaCacheStats{Revalidated: 1, Misses: 1, StoredEntries: 1}},
+		{"TTLが0ならキャッシュしない", 0, 0, nil, 2, 0,
+			qiitaCacheStats{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, notModified int32
+			server := qiitaCacheServer(t, `[{"id":"1"}]`, &calls, &notModified)
+			cache := newTestQiitaCache(http.DefaultTransport, tt.ttl)
+
+			if status, body := getThroughCache(t, cache, server.URL, nil); status != http.StatusOK || body != `[{"id":"1"}]` {
+				t.Fatalf("1回目 = %d %q", status, body)
+			}
+			for _, entry := range cache.entries {
+				entry.StoredAt = entry.StoredAt.Add(-tt.age)
+			}
+			if status, body := getThroughCache(t, cache, server.URL, tt.header); status != http.StatusOK || body != `[{"id":"1"}]` {
+				t.Fatalf("2回目 = %d %q", status, body)
+			}
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if got := atomic.LoadInt32(&notModified); got != tt.wantNotModified {
+				t.Errorf("304 = %d, want %d", got, tt.wantNotModified)
+			}
+			if got := cache.Stats(); got != tt.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestQiitaCacheTransportRevalidationRefreshesEntry(t *testing.T) {
+	var calls, notModified int32
+	server := qiitaCacheServer(t, "body", &calls, &notModified)
+	cache := newTestQiitaCache(http.DefaultTransport, time.Hour)
+
+	getThroughCache(t, cache, server.URL, nil)
+	cache.entries[server.URL].StoredAt = time.Now().Add(-2 * time.Hour)
+	getThroughCache(t, cache, server.URL, nil)
+	// 304で保存し直したので、3回目はTTL内としてQiitaに問い合わせない
+	getThroughCache(t, cache, server.URL, nil)
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+	if age := time.Since(cache.entries[server.URL].StoredAt); age > time.Minute {
+		t.Errorf("StoredAt was not refreshed (age %s)", age)
+	}
+}
+
+func TestQiitaCacheTransportSkipsErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	cache := newTestQiitaCache(http.DefaultTransport, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if status, _ := getThroughCache(t, cache, server.URL, nil); status != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", status, http.StatusNotFound)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestQiitaCacheTransportRateLimited(t *testing.T) {
+	rateLimited := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errQiitaRateLimited
+	})
+	const url = "https://qiita.com/api/v2/items?page=1"
+	stale := func() *qiitaCacheTransport {
+		cache := newTestQiitaCache(rateLimited, time.Hour)
+		cache.entries[url] = &cachedResponse{
+			URL:      url,
+			Header:   http.Header{},
+			Body:     []byte("stale"),
+			StoredAt: time.Now().Add(-2 * time.Hour),
+		}
+		return cache
+	}
+
+	t.Run("期限切れのキャッシュを使う", func(t *testing.T) {
+		if status, body := getThroughCache(t, stale(), url, nil); status != http.StatusOK || body != "stale" {
+			t.Errorf("got %d %q, want 200 %q", status, body, "stale")
+		}
+	})
+
+	tests := []struct {
+		name   string
+		cache  *qiitaCacheTransport
+		header http.Header
+	}{
+		{"no-cacheでは古いキャッシュを使わない", stale(), http.Header{"Cache-Control": {"no-cache"}}},
+		{"キャッシュがなければエラー", newTestQiitaCache(rateLimited, time.Hour), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header = tt.header
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			if _, err := tt.cache.RoundTrip(req); !errors.Is(err, errQiitaRateLimited) {
+				t.Errorf("err = %v, want %v", err, errQiitaRateLimited)
+			}
+		})
+	}
+}
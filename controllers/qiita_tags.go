@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"qiita-search/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// qiitaTags はQiitaのタグ一覧から作った別名テーブルを共有する
+var qiitaTags = &tagCatalog{}
+
+// tagCatalog はQiitaの /api/v2/tags から取得したタグ一覧を保持する
+// 取得件数は QIITA_TAG_SEED_PAGES（1ページ100件）、再取得の間隔は QIITA_TAG_SEED_TTL、
+// 取得に失敗した場合に再試行するまでの間隔は QIITA_TAG_SEED_RETRY で変更できる
+type tagCatalog struct {
+	mu       sync.Mutex
+	tags     []models.QiitaTag
+	aliases  *models.TagAliases
+	loadedAt time.Time
+	// 取得中かどうかと、失敗した後に次に取得を試す時刻
+	loading bool
+	retryAt time.Time
+}
+
+// aliasTable は別名テーブルを返す。期限切れの場合はQiitaから再取得する
+// 取得はロックの外で1つの呼び出しだけが行い、その間ほかの呼び出しは手元の別名（なければ組み込みの別名）を使う
+func (tc *tagCatalog) aliasTable(ctx context.Context) *models.TagAliases {
+	tc.mu.Lock()
+	if tc.aliases == nil {
+		tc.aliases = models.NewTagAliases(nil)
+	}
+	fresh := !tc.loadedAt.IsZero() && time.Since(tc.loadedAt) < envDuration("QIITA_TAG_SEED_TTL", 24*time.Hour)
+	if fresh || tc.loading || time.Now().Before(tc.retryAt) {
+		aliases := tc.aliases
+		tc.mu.Unlock()
+		return aliases
+	}
+	tc.loading = true
+	tc.mu.Unlock()
+
+	// 呼び出し元のルームの期限に左右されないよう、取得には専用の期限を使う
+	fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), envDuration("QIITA_TAG_SEED_TIMEOUT", time.Minute))
+	tags, err := fetchQiitaTags(fetchCtx, envInt("QIITA_TAG_SEED_PAGES", 5))
+	cancel()
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.loading = false
+	if err != nil {
+		// 一時的な失敗で長く組み込みの別名だけにならないよう、短い間隔で再試行する
+		log.Printf("Qiitaのタグ一覧の取得に失敗しました: %v", err)
+		tc.retryAt = time.Now().Add(envDuration("QIITA_TAG_SEED_RETRY", 5*time.Minute))
+		return tc.aliases
+	}
+
+	tc.tags = tags
+	tc.aliases = models.NewTagAliases(tags)
+	tc.loadedAt = time.Now()
+	return tc.aliases
+}
+
+// resolveExpr は分野の式に含まれる語を正式なQiitaタグ名に変換する
+func (tc *tagCatalog) resolveExpr(ctx context.Context, expr *models.FieldExpr) {
+	tc.aliasTable(ctx).ResolveExpr(expr)
+}
+
+// fetchQiitaTags はQiitaのタグを記事数の多い順に取得する
+func fetchQiitaTags(ctx context.Context, pages int) ([]models.QiitaTag, error) {
+	var tags []models.QiitaTag
+	for page := 1; page <= pages; page++ {
+		var pageTags []models.QiitaTag
+		found, err := getQiita(ctx, fmt.Sprintf("https://qiita.com/api/v2/tags?page=%d&per_page=100&sort=count", page), &pageTags)
+		if err != nil {
+			return nil, err
+		}
+		if !found || len(pageTags) == 0 {
+			break
+		}
+		tags = append(tags, pageTags...)
+	}
+	return tags, nil
+}
+
+// describeAlias は別名を変換した場合に利用者へ伝える文言を返す
+func describeAlias(input, canonical string) string {
+	if strings.EqualFold(strings.Join(strings.Fields(input), " "), canonical) {
+		return ""
+	}
+	return fmt.Sprintf("%s → %s", input, canonical)
+}
+
+// fetchQiitaTag は /api/v2/tags/:id からタグ情報を取得する。タグが存在しない場合はnilを返す
+func fetchQiitaTag(ctx context.Context, id string) (*models.QiitaTag, error) {
+	var tag models.QiitaTag
+	found, err := getQiita(ctx, "https://qiita.com/api/v2/tags/"+url.PathEscape(id), &tag)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// suggest はタグ一覧から似た名前のタグを探す
+func (tc *tagCatalog) suggest(ctx context.Context, word string) []string {
+	tc.aliasTable(ctx)
+
+	tc.mu.Lock()
+	tags := tc.tags
+	tc.mu.Unlock()
+	return models.SuggestTags(word, tags, 3)
+}
+
+// complete はタグ一覧から、prefixで始まるタグを記事数の多い順に最大limit件返す（大文字・小文字は区別しない）
+// 前方一致するタグがなければ、似た名前のタグを返す
+func (tc *tagCatalog) complete(ctx context.Context, prefix string, limit int) []string {
+	tc.aliasTable(ctx)
+
+	tc.mu.Lock()
+	tags := tc.tags
+	tc.mu.Unlock()
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return nil
+	}
+	// タグ一覧は記事数の多い順に取得している
+	var names []string
+	for _, tag := range tags {
+		if strings.HasPrefix(strings.ToLower(tag.ID), prefix) {
+			names = append(names, tag.ID)
+			if len(names) >= limit {
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return models.SuggestTags(prefix, tags, limit)
+	}
+	return names
+}
+
+// validateFieldExpr は式に含まれるタグがすべてQiitaに存在するか確認し、語をQiita上の正式なタグ名に直す
+// 利用者に返す状態の文言と、登録してよいかどうかを返す
+func validateFieldExpr(ctx context.Context, expr *models.FieldExpr) (string, bool) {
+	minItems := envInt("QIITA_TAG_MIN_ITEMS", 1)
+
+	canonical := make(map[string]string)
+	var details []string
+	for _, word := range expr.Words() {
+		if _, ok := canonical[word]; ok {
+			continue
+		}
+
+		tag, err := fetchQiitaTag(ctx, word)
+		if err != nil {
+			log.Printf("タグ %s の確認に失敗しました: %v", word, err)
+			return "Qiitaでタグを確認できませんでした。時間をおいて再度お試しください", false
+		}
+
+		if tag == nil {
+			status := fmt.Sprintf("Qiitaに「%s」というタグが見つかりませんでした", word)
+			if suggestions := qiitaTags.suggest(ctx, word); len(suggestions) > 0 {
+				status += fmt.Sprintf("。もしかして: %s？", strings.Join(suggestions, "、"))
+			}
+			return status, false
+		}
+
+		if tag.ItemsCount < minItems {
+			return fmt.Sprintf("タグ「%s」の記事が%d件しかないため登録できませんでした", tag.ID, tag.ItemsCount), false
+		}
+
+		canonical[word] = tag.ID
+		details = append(details, fmt.Sprintf("%s: 記事%d件 / フォロワー%d人", tag.ID, tag.ItemsCount, tag.FollowersCount))
+	}
+
+	expr.MapTerms(func(word string) string { return canonical[word] })
+	return strings.Join(details, "、"), true
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestQiitaTransport はテスト用に待ち時間を短くした qiitaTransport を作る
+func newTestQiitaTransport(maxRetries int) *qiitaTransport {
+	return &qiitaTransport{
+		base:       http.DefaultTransport,
+		maxRetries: maxRetries,
+		baseDelay:  time.Millisecond,
+		maxDelay:   time.Millisecond,
+	}
+}
+
+func TestQiitaTransportRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int // リクエストごとに返すステータス（足りない分は最後のものを返す）
+		maxRetries int
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"成功はリトライしない", []int{200}, 3, 200, 1},
+		{"404はリトライしない", []int{404}, 3, 404, 1},
+		{"429の後に成功", []int{429, 200}, 3, 200, 2},
+		{"5xxが続いた後に成功", []int{500, 503, 200}, 3, 200, 3},
+		{"リトライの上限で最後のレスポンスを返す", []int{503}, 2, 503, 3},
+		{"リトライしない設定", []int{500}, 0, 500, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&calls, 1))
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: newTestQiitaTransport(tt.maxRetries)}
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("リクエストに失敗しました: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestQiitaTransportRetryCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	transport := newTestQiitaTransport(3)
+	transport.maxDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+
+	_, err := (&http.Client{Transport: transport}).Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestQiitaTransportBackoff(t *testing.T) {
+	transport := &qiitaTransport{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	t.Run("Retry-Afterを優先する", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{"Retry-After": {"0"}}}
+		if got := transport.backoff(3, resp); got != 0 {
+			t.Errorf("backoff = %s, want 0", got)
+		}
+	})
+	t.Run("Retry-AfterはmaxDelayまで", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{"Retry-After": {"120"}}}
+		if got := transport.backoff(0, resp); got != time.Second {
+			t.Errorf("backoff = %s, want %s", got, time.Second)
+		}
+	})
+
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{40, time.Second},
+		{1000, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run("attempt="+strconv.Itoa(tt.attempt), func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			for i := 0; i < 100; i++ {
+				got := transport.backoff(tt.attempt, resp)
+				if got <= 0 || got > tt.ceiling {
+					t.Fatalf("backoff = %s, want (0, %s]", got, tt.ceiling)
+				}
+			}
+		})
+	}
+}
+
+func TestQiitaTransportQuota(t *testing.T) {
+	t.Run("残りが0の間はリクエストを送らない", func(t *testing.T) {
+		var calls int32
+		reset := time.Now().Add(time.Hour).Unix()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Rate-Limit", "1000")
+			w.Header().Set("Rate-Remaining", "0")
+			w.Header().Set("Rate-Reset", strconv.FormatInt(reset, 10))
+		}))
+		defer server.Close()
+
+		transport := newTestQiitaTransport(0)
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("リクエストに失敗しました: %v", err)
+		}
+		resp.Body.Close()
+
+		quota, known := transport.Quota()
+		if !known || quota.Limit != 1000 || quota.Remaining != 0 || quota.ResetAt.Unix() != reset || quota.Requests != 1 {
+			t.Errorf("Quota() = %+v, %v", quota, known)
+		}
+
+		_, err = client.Get(server.URL)
+		if !errors.Is(err, errQiitaRateLimited) {
+			t.Errorf("err = %v, want %v", err, errQiitaRateLimited)
+		}
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Errorf("calls = %d, want 1", got)
+		}
+	})
+
+	t.Run("リセット時刻を過ぎたら上限まで回復する", func(t *testing.T) {
+		transport := &qiitaTransport{known: true, limit: 1000, remaining: 0, resetAt: time.Now().Add(-time.Minute)}
+		quota, known := transport.Quota()
+		if !known || quota.Remaining != 1000 {
+			t.Errorf("Quota() = %+v, %v, want remaining 1000", quota, known)
+		}
+	})
+
+	t.Run("ヘッダーがなければ不明のまま", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		transport := newTestQiitaTransport(0)
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			t.Fatalf("リクエストに失敗しました: %v", err)
+		}
+		resp.Body.Close()
+		if quota, known := transport.Quota(); known || quota.Requests != 1 {
+			t.Errorf("Quota() = %+v, %v, want unknown", quota, known)
+		}
+	})
+}
+
+func TestQiitaTransportWaitForQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport *qiitaTransport
+		maxPause  time.Duration
+		want      bool
+	}{
+		{"状態が不明", &qiitaTransport{}, 0, true},
+		{"残りが十分", &qiitaTransport{known: true, limit: 1000, remaining: 100, resetAt: time.Now().Add(time.Hour)}, 0, true},
+		{"リセットまで待てない", &qiitaTransport{known: true, limit: 1000, remaining: 5, resetAt: time.Now().Add(time.Hour)}, time.Minute, false},
+		{"リセットまで待つ", &qiitaTransport{known: true, limit: 1000, remaining: 5, resetAt: time.Now().Add(10 * time.Millisecond)}, time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.transport.waitForQuota(10, tt.maxPause, nil); got != tt.want {
+				t.Errorf("waitForQuota = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("待機中に中断する", func(t *testing.T) {
+		transport := &qiitaTransport{known: true, limit: 1000, remaining: 5, resetAt: time.Now().Add(time.Hour)}
+		done := make(chan struct{})
+		close(done)
+		if transport.waitForQuota(10, 2*time.Hour, done) {
+			t.Error("waitForQuota = true, want false")
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"qiita-search/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 記事の探し方
+const (
+	strategyTag      = "tag"      // 分野のタグで検索
+	strategyTitle    = "title"    // 分野の語をタイトルから検索
+	strategyBody     = "body"     // 分野の語を本文から検索
+	strategyRelated  = "related"  // 分野のタグと一緒に使われることが多いタグで検索
+	strategyTrending = "trending" // 最近投稿された記事のうち、ストック数・いいね数の伸びが大きい記事（分野があれば分野の中から）
+	strategyGlobal   = "global"   // 分野に関係なく人気の記事
+)
+
+// 1つの探し方で検索する既定のページ数
+const defaultStrategyPages = 4
+
+// searchStrategy は記事の探し方と、その探し方で検索するページ数
+type searchStrategy struct {
+	Name  string
+	Pages int
+}
+
+// ルームに設定がない場合の探し方（タグ → タイトル → 全体の人気記事）
+var defaultSearchStrategies = []searchStrategy{
+	{Name: strategyTag, Pages: defaultStrategyPages},
+	{Name: strategyTitle, Pages: defaultStrategyPages},
+	{Name: strategyGlobal, Pages: defaultStrategyPages},
+}
+
+// parseSearchStrategies は userテーブルの search_strategy（例: "tag:4,title:2,related,global"）を解析する
+// ページ数を省略した場合は4ページ。解釈できない要素は無視し、何も残らなければ既定の探し方を使う
+func parseSearchStrategies(spec string) []searchStrategy {
+	var strategies []searchStrategy
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, pagesText, hasPages := strings.Cut(part, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		pages := defaultStrategyPages
+		if hasPages {
+			n, err := strconv.Atoi(strings.TrimSpace(pagesText))
+			if err != nil || n <= 0 {
+				log.Printf("探し方 %q のページ数が不正です", part)
+				continue
+			}
+			pages = n
+		}
+
+		switch name {
+		case strategyTag, strategyTitle, strategyBody, strategyRelated, strategyTrending, strategyGlobal:
+			strategies = append(strategies, searchStrategy{Name: name, Pages: pages})
+		default:
+			log.Printf("不明な探し方 %q を無視します", name)
+		}
+	}
+
+	if len(strategies) == 0 {
+		return defaultSearchStrategies
+	}
+	return strategies
+}
+
+// usesField は分野をもとに検索する探し方かどうかを返す
+func (s searchStrategy) usesField() bool {
+	switch s.Name {
+	case strategyTag, strategyTitle, strategyBody, strategyRelated:
+		return true
+	}
+	return false
+}
+
+// strategyQuery は探し方に応じたQiitaの検索クエリを返す。この探し方が使えない場合はfalseを返す
+// minStocksは分野ごとのストック数の条件で、分野を使う探し方にだけ適用する
+// クエリを作るための検索（関連タグ）に失敗した場合はエラーを返す
+func (ac *ArticleController) strategyQuery(ctx context.Context, strategy searchStrategy, expr *models.FieldExpr, minStocks int) (string, bool, error) {
+	stocks := fmt.Sprintf("stocks:>=%d", minStocks)
+	switch strategy.Name {
+	case strategyTag:
+		return expr.Query("tag", stocks), true, nil
+	case strategyTitle:
+		return expr.Query("title", stocks), true, nil
+	case strategyBody:
+		return expr.Query("body", stocks), true, nil
+	case strategyRelated:
+		related, err := ac.relatedTags(ctx, expr, minStocks, 3)
+		if err != nil {
+			return "", false, err
+		}
+		if len(related) == 0 {
+			return "", false, nil
+		}
+		// 関連タグのどれかが付いた記事を探す（タグごとにOR条件にする）
+		relatedExpr := &models.FieldExpr{}
+		for _, tag := range related {
+			relatedExpr.Clauses = append(relatedExpr.Clauses, models.FieldClause{Terms: []models.FieldTerm{{Value: tag}}})
+		}
+		return relatedExpr.Query("tag", stocks), true, nil
+	case strategyTrending:
+		return ac.trendingQuery(expr), true, nil
+	case strategyGlobal:
+		return "stocks:>=30", true, nil
+	}
+	return "", false, nil
+}
+
+// relatedTags は分野のタグの人気記事で一緒に付けられていることが多いタグを、多い順に最大limit件返す
+// 検索に失敗した場合は、記事が見つからなかった場合と区別できるようエラーを返す（レート制限は errQiitaRateLimited）
+func (ac *ArticleController) relatedTags(ctx context.Context, expr *models.FieldExpr, minStocks, limit int) ([]string, error) {
+	articles, err := ac.searchArticles(ctx, qiitaSearchURL(1, expr.Query("tag", fmt.Sprintf("stocks:>=%d", minStocks))))
+	if errors.Is(err, errQiitaRateLimited) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, withOutcome(outcomeUpstreamError, err)
+	}
+
+	own := make(map[string]bool)
+	for _, word := range expr.Words() {
+		own[strings.ToLower(word)] = true
+	}
+
+	counts := make(map[string]int)
+	for _, article := range articles {
+		for _, tag := range article.Tags {
+			if !own[strings.ToLower(tag.Name)] {
+				counts[tag.Name]++
+			}
+		}
+	}
+
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchStrategies(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []searchStrategy
+	}{
+		{"", defaultSearchStrategies},
+		{"tag", []searchStrategy{{Name: strategyTag, Pages: defaultStrategyPages}}},
+		{"tag:4,title:2,related,global", []searchStrategy{
+			{Name: strategyTag, Pages: 4},
+			{Name: strategyTitle, Pages: 2},
+			{Name: strategyRelated, Pages: defaultStrategyPages},
+			{Name: strategyGlobal, Pages: defaultStrategyPages},
+		}},
+		{" Trending : 1 , BODY ", []searchStrategy{
+			{Name: strategyTrending, Pages: 1},
+			{Name: strategyBody, Pages: defaultStrategyPages},
+		}},
+		{"tag:0,title:x,unknown,global:3", []searchStrategy{{Name: strategyGlobal, Pages: 3}}},
+		{"unknown,tag:-1", defaultSearchStrategies},
+		{",,", defaultSearchStrategies},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if got := parseSearchStrategies(tt.spec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchStrategies(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
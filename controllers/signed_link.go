@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 署名と有効期限（Unix時刻）を入れるクエリパラメータ名
+const (
+	linkSignatureParam = "sig"
+	linkExpiresParam   = "exp"
+)
+
+var (
+	errLinkInvalid = errors.New("リンクが無効です")
+	errLinkExpired = errors.New("リンクの有効期限が切れています")
+)
+
+// signParams はリンクのパス（/save など）とパラメータ（署名を除く）のHMAC-SHA256署名を返す。鍵は LINK_SECRET
+// パスも署名に含め、あるページ用のリンクをほかのページに使えないようにする
+func signParams(path string, params url.Values, secret string) string {
+	unsigned := url.Values{}
+	for key, values := range params {
+		if key != linkSignatureParam {
+			unsigned[key] = values
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	// Encode はキーの順に並べるため、パラメータの順序が変わっても同じ署名になる
+	mac.Write([]byte(path + "?" + unsigned.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedLink はパラメータに有効期限と署名を付けたリンクを返す。有効期限は LINK_TTL（既定は30日）
+// LINK_SECRET が設定されていない場合は、改ざんを防げないためリンクを作らずにfalseを返す
+func signedLink(path string, params url.Values) (string, bool) {
+	secret := os.Getenv("LINK_SECRET")
+	if secret == "" {
+		return "", false
+	}
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8082" // デフォルト値
+	}
+	signed := url.Values{}
+	for key, values := range params {
+		signed[key] = values
+	}
+	expires := time.Now().Add(envDuration("LINK_TTL", 30*24*time.Hour))
+	signed.Set(linkExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	signed.Set(linkSignatureParam, signParams(path, signed, secret))
+	return baseURL + path + "?" + signed.Encode(), true
+}
+
+// verifySignedParams はpath用に署名したリンクのパラメータが改ざんされておらず、有効期限内であることを確認する
+func verifySignedParams(path string, params url.Values) error {
+	secret := os.Getenv("LINK_SECRET")
+	if secret == "" {
+		return errLinkInvalid
+	}
+	expected := signParams(path, params, secret)
+	if !hmac.Equal([]byte(params.Get(linkSignatureParam)), []byte(expected)) {
+		return errLinkInvalid
+	}
+	expires, err := strconv.ParseInt(params.Get(linkExpiresParam), 10, 64)
+	if err != nil {
+		return errLinkInvalid
+	}
+	if time.Now().Unix() > expires {
+		return errLinkExpired
+	}
+	return nil
+}
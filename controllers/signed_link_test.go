@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignedParams(t *testing.T) {
+	t.Setenv("LINK_SECRET", "test-secret")
+	t.Setenv("BASE_URL", "https://example.com")
+
+	link, ok := signedLink("/save", url.Values{"room_id": {"123"}, "url": {"https://qiita.com/a/items/1"}})
+	if !ok {
+		t.Fatal("signedLink がリンクを作りませんでした")
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("リンクを解析できません: %v", err)
+	}
+	if parsed.Host != "example.com" || parsed.Path != "/save" {
+		t.Fatalf("リンクのURLが BASE_URL とパスから作られていません: %s", link)
+	}
+	signed := parsed.Query()
+
+	// signed を変えずに、値を変えたコピーを返す
+	with := func(key, value string) url.Values {
+		params := url.Values{}
+		for k, v := range signed {
+			params[k] = append([]string(nil), v...)
+		}
+		if value == "" {
+			params.Del(key)
+		} else {
+			params.Set(key, value)
+		}
+		return params
+	}
+
+	// 署名の先頭の1文字を必ず別の16進数字に変える
+	sig := signed.Get(linkSignatureParam)
+	tampered := "0" + sig[1:]
+	if sig[0] == '0' {
+		tampered = "1" + sig[1:]
+	}
+
+	expired := url.Values{"room_id": {"123"}}
+	expired.Set(linkExpiresParam, strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+	expired.Set(linkSignatureParam, signParams("/save", expired, "test-secret"))
+
+	tests := []struct {
+		name   string
+		path   string
+		params url.Values
+		want   error
+	}{
+		{"有効なリンク", "/save", signed, nil},
+		{"パラメータの改ざん", "/save", with("room_id", "456"), errLinkInvalid},
+		{"パラメータの追加", "/save", with("account_id", "1"), errLinkInvalid},
+		{"有効期限の延長", "/save", with(linkExpiresParam, strconv.FormatInt(time.Now().Add(time.Hour*24*365).Unix(), 10)), errLinkInvalid},
+		{"署名の削除", "/save", with(linkSignatureParam, ""), errLinkInvalid},
+		{"署名の改ざん", "/save", with(linkSignatureParam, tampered), errLinkInvalid},
+		{"ほかのページ用のリンク", "/feedback", signed, errLinkInvalid},
+		{"有効期限切れ", "/save", expired, errLinkExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifySignedParams(tt.path, tt.params); !errors.Is(err, tt.want) {
+				t.Errorf("verifySignedParams() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedLinkWithoutSecret(t *testing.T) {
+	t.Setenv("LINK_SECRET", "")
+
+	if link, ok := signedLink("/save", url.Values{"room_id": {"123"}}); ok {
+		t.Errorf("LINK_SECRET がなくてもリンクを作りました: %s", link)
+	}
+	params := url.Values{"room_id": {"123"}}
+	params.Set(linkExpiresParam, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	params.Set(linkSignatureParam, signParams("/save", params, ""))
+	if err := verifySignedParams("/save", params); !errors.Is(err, errLinkInvalid) {
+		t.Errorf("verifySignedParams() = %v, want %v", err, errLinkInvalid)
+	}
+}
+
+func TestSignParamsIgnoresOrder(t *testing.T) {
+	a := url.Values{}
+	a.Add("b", "2")
+	a.Add("a", "1")
+	b := url.Values{}
+	b.Add("a", "1")
+	b.Add("b", "2")
+	b.Set(linkSignatureParam, "ignored")
+	if signParams("/save", a, "k") != signParams("/save", b, "k") {
+		t.Error("パラメータの順序や sig によって署名が変わりました")
+	}
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"qiita-search/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// articleSnapshot は article_snapshotテーブルの1行（ある時点での記事のストック数・いいね数）
+type articleSnapshot struct {
+	ItemID     string    `json:"item_id"`
+	ArticleURL string    `json:"article_url"`
+	Stocks     int       `json:"stocks_count"`
+	Likes      int       `json:"likes_count"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// trendingQuery は最近投稿された記事を探すクエリを返す。exprがnilの場合はQiita全体から探す
+func (ac *ArticleController) trendingQuery(expr *models.FieldExpr) string {
+	since := time.Now().In(jst).AddDate(0, 0, -ac.trendingDays).Format("2006-01-02")
+	query := fmt.Sprintf("created:>=%s stocks:>=%d", since, ac.trendingMinStocks)
+	if expr != nil {
+		return expr.Query("tag", query)
+	}
+	return query
+}
+
+// findTrendingArticle は最近投稿された記事を最大pagesページ取得し、
+// ストック数・いいね数の伸び（1時間あたり）が大きい順に、ルームにまだ配信していない記事を探す
+func (ac *ArticleController) findTrendingArticle(ctx context.Context, roomID string, pages int, query string, skip func(models.Article) bool) (models.Article, bool, error) {
+	articles, err := ac.collectRecentArticles(ctx, pages, query)
+	if err != nil {
+		return models.Article{}, false, err
+	}
+	if len(articles) == 0 {
+		return models.Article{}, false, nil
+	}
+
+	now := time.Now()
+	history, err := fetchSnapshots(ctx, articles, now.Add(-ac.trendingWindow))
+	if err != nil {
+		// 過去の記録がなくても投稿からの経過時間で伸びを計算できるため、続ける
+		log.Printf("記事の記録の取得に失敗しました: %v", err)
+	}
+	if err := saveSnapshots(ctx, articles, now); err != nil {
+		log.Printf("記事の記録の保存に失敗しました: %v", err)
+	}
+
+	velocity := make(map[string]float64, len(articles))
+	for _, article := range articles {
+		velocity[article.ID] = articleVelocity(article, history[article.ID], now)
+	}
+	sort.SliceStable(articles, func(i, j int) bool {
+		return velocity[articles[i].ID] > velocity[articles[j].ID]
+	})
+
+	var lastErr error
+	for _, article := range articles {
+		if skip(article) {
+			continue
+		}
+		delivered, err := isDelivered(ctx, roomID, article.URL)
+		if err != nil {
+			log.Printf("配信履歴の確認に失敗しました: %v", err)
+			lastErr = err
+			continue
+		}
+		if !delivered {
+			return article, true, nil
+		}
+	}
+	if lastErr != nil {
+		return models.Article{}, false, withOutcome(outcomeUpstreamError, lastErr)
+	}
+	return models.Article{}, false, nil
+}
+
+// collectRecentArticles は最大pagesページまで記事を検索して返す
+// 取得したストック数・いいね数はその時点の値として記録するため、キャッシュは使わない
+func (ac *ArticleController) collectRecentArticles(ctx context.Context, pages int, query string) ([]models.Article, error) {
+	ctx = withFreshQiita(ctx)
+	var collected []models.Article
+	var lastErr error
+	for page := 1; page <= pages; page++ {
+		articles, err := ac.searchArticles(ctx, qiitaSearchURL(page, query))
+		if errors.Is(err, errQiitaRateLimited) {
+			return nil, err
+		}
+		if err != nil {
+			log.Printf("記事の検索に失敗しました（%d ページ目）: %v", page, err)
+			lastErr = err
+			continue
+		}
+		if len(articles) == 0 {
+			break
+		}
+		collected = append(collected, articles...)
+	}
+	if len(collected) == 0 && lastErr != nil {
+		return nil, withOutcome(outcomeUpstreamError, lastErr)
+	}
+	return collected, nil
+}
+
+// articleVelocity は記事のストック数・いいね数の1時間あたりの伸びを返す
+// 期間内の記録があれば最も古い記録からの伸び、なければ投稿からの平均の伸びを使う
+func articleVelocity(article models.Article, history []articleSnapshot, now time.Time) float64 {
+	score := float64(article.Stocks + article.Likes)
+	if len(history) > 0 {
+		oldest := history[0]
+		hours := now.Sub(oldest.ObservedAt).Hours()
+		if hours >= 1 {
+			return (score - float64(oldest.Stocks+oldest.Likes)) / hours
+		}
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, article.CreatedAt)
+	if err != nil {
+		return 0
+	}
+	// 投稿直後の記事が極端に高くならないよう、経過時間は1時間以上として計算する
+	return score / max(now.Sub(createdAt).Hours(), 1)
+}
+
+// fetchSnapshots は記事ごとに、since以降の記録を古い順に取得する
+func fetchSnapshots(ctx context.Context, articles []models.Article, since time.Time) (map[string][]articleSnapshot, error) {
+	ids := make([]string, 0, len(articles))
+	for _, article := range articles {
+		if article.ID != "" {
+			ids = append(ids, `"`+article.ID+`"`)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var snapshots []articleSnapshot
+	err := getRows(ctx,
+		fmt.Sprintf("article_snapshot?select=*&item_id=in.(%s)&observed_at=gte.%s&order=observed_at.asc",
+			url.QueryEscape(strings.Join(ids, ",")),
+			url.QueryEscape(since.UTC().Format(time.RFC3339))),
+		&snapshots)
+	if err != nil {
+		return nil, err
+	}
+	history := make(map[string][]articleSnapshot)
+	for _, s := range snapshots {
+		history[s.ItemID] = append(history[s.ItemID], s)
+	}
+	return history, nil
+}
+
+// saveSnapshots は記事の現在のストック数・いいね数を記録する
+func saveSnapshots(ctx context.Context, articles []models.Article, now time.Time) error {
+	snapshots := make([]articleSnapshot, 0, len(articles))
+	for _, article := range articles {
+		if article.ID == "" {
+			continue
+		}
+		snapshots = append(snapshots, articleSnapshot{
+			ItemID:     article.ID,
+			ArticleURL: article.URL,
+			Stocks:     article.Stocks,
+			Likes:      article.Likes,
+			ObservedAt: now.UTC(),
+		})
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	snapshotsJSON, err := json.Marshal(snapshots)
+	if err != nil {
+		return err
+	}
+	req, err := newSupabaseRequest(ctx, "POST", "article_snapshot", bytes.NewReader(snapshotsJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	resp, err := supabaseClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Supabaseエラー (%d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// pruneSnapshots は保存期間を過ぎた記録を削除する
+func pruneSnapshots(ctx context.Context, before time.Time) error {
+	return deleteRows(ctx, "article_snapshot?observed_at=lt."+url.QueryEscape(before.UTC().Format(time.RFC3339)))
+}
+
+// Snapshot は登録されているすべての分野と、Qiita全体の最近の記事のストック数・いいね数を記録するハンドラー
+// 伸びを正確に計算できるよう、cronなどから定期的に（例: 1時間ごとに）呼び出す
+func (ac *ArticleController) Snapshot(c echo.Context) error {
+	ctx := context.WithoutCancel(c.Request().Context())
+
+	fields, err := fetchFields(ctx, "")
+	if err != nil {
+		log.Printf("分野情報の取得に失敗しました: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "分野情報の取得に失敗しました",
+		})
+	}
+
+	// 同じ分野を登録しているルームが複数あっても1回だけ検索する
+	queries := []string{ac.trendingQuery(nil)}
+	seen := map[string]bool{queries[0]: true}
+	for _, field := range fields {
+		if field.isFollow() {
+			continue
+		}
+		query := ac.trendingQuery(parseStoredField(ctx, field.Name))
+		if !seen[query] {
+			seen[query] = true
+			queries = append(queries, query)
+		}
+	}
+
+	now := time.Now()
+	recorded := 0
+	skipped := 0
+	for i, query := range queries {
+		if !qiitaRateLimiter.waitForQuota(ac.quotaReserve, ac.ratePauseMax, ctx.Done()) {
+			skipped = len(queries) - i
+			log.Printf("Qiita APIの残りリクエスト数が不足しているため、%d 件の分野の記録を見送ります", skipped)
+			break
+		}
+
+		queryCtx, cancel := context.WithTimeout(ctx, ac.roomTimeout)
+		articles, err := ac.collectRecentArticles(queryCtx, ac.trendingPages, query)
+		if err == nil {
+			err = saveSnapshots(queryCtx, articles, now)
+		}
+		cancel()
+		if err != nil {
+			log.Printf("記事の記録に失敗しました（%s）: %v", query, err)
+			continue
+		}
+		recorded += len(articles)
+	}
+
+	if err := pruneSnapshots(ctx, now.Add(-ac.snapshotRetention)); err != nil {
+		log.Printf("古い記事の記録の削除に失敗しました: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "記事の記録が完了しました",
+		"queries":  len(queries),
+		"recorded": recorded,
+		"skipped":  skipped,
+	})
+}
@@ -2,12 +2,15 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"qiita-search/models"
 	"strings"
 
 	"github.com/labstack/echo/v4"
@@ -16,6 +19,7 @@ import (
 type UserController struct{}
 
 func NewUserController() *UserController {
+	setupClients()
 	return &UserController{}
 }
 
@@ -23,6 +27,8 @@ func (uc *UserController) Register(c echo.Context) error {
 	// リクエストパラメータを取得
 	message := c.QueryParam("message")
 	roomID := c.QueryParam("room_id")
+	// メッセージを送ったメンバー（Webhookから渡された場合のみ）
+	accountID := c.QueryParam("account_id")
 
 	fmt.Printf("受信したメッセージ: %s\n", message)
 	fmt.Printf("受信したroom_id: %s\n", roomID)
@@ -38,32 +44,13 @@ func (uc *UserController) Register(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "Supabaseの設定が不足しています")
 	}
 
-	// userテーブルでroom_idの存在確認
-	client := &http.Client{}
-	userReq, err := http.NewRequest("GET",
-		fmt.Sprintf("%s/rest/v1/user?room_id=eq.%s", supabaseURL, roomID),
-		nil)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, "リクエストの作成に失敗しました")
-	}
-
-	userReq.Header.Set("apikey", supabaseKey)
-	userReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-	userReq.Header.Set("Content-Type", "application/json")
+	ctx := c.Request().Context()
 
-	userResp, err := client.Do(userReq)
+	// userテーブルでroom_idの存在確認
+	room, err := fetchRoom(ctx, roomID)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "APIリクエストに失敗しました")
-	}
-	defer userResp.Body.Close()
-
-	var users []map[string]interface{}
-	if err := json.NewDecoder(userResp.Body).Decode(&users); err != nil {
-		return c.String(http.StatusInternalServerError, "JSONのパースに失敗しました")
-	}
-
-	if len(users) == 0 {
-		return c.String(http.StatusBadRequest, "指定されたルームIDは登録されていません")
+		log.Printf("ルーム %s の取得に失敗しました: %v", roomID, err)
+		return c.String(http.StatusInternalServerError, "ルームの取得に失敗しました")
 	}
 
 	// メッセージをURLデコード
@@ -85,16 +72,78 @@ func (uc *UserController) Register(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "ChatworkのAPIトークンが設定されていません")
 	}
 
+	// 未登録のルームは、参加の依頼（/join、ボットへのメンション）だけを受け付ける
+	if room == nil {
+		if !isJoinRequest(decodedMessage) {
+			return c.String(http.StatusBadRequest, "指定されたルームIDは登録されていません")
+		}
+		if _, err := postChatworkMessage(ctx, roomID, uc.joinRoom(ctx, roomID)); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "メッセージの送信に失敗しました",
+			})
+		}
+		return c.String(http.StatusOK, "OK")
+	}
+
+	// ボットへのメンションで送られたメッセージは、メンションを除いた本文をコマンド・分野として扱う
+	decodedMessage = stripBotMention(decodedMessage)
+	if decodedMessage == "" {
+		return c.String(http.StatusOK, "OK")
+	}
+
+	// 「/」で始まるメッセージはコマンドとして扱う
+	if isCommand(decodedMessage) {
+		reply := uc.handleCommand(ctx, roomID, accountID, decodedMessage)
+		if _, err := postChatworkMessage(ctx, roomID, reply); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "メッセージの送信に失敗しました",
+			})
+		}
+		return c.String(http.StatusOK, "OK")
+	}
+
+	// メッセージ本文の分野をルーム全体の分野として登録する
+	statuses := uc.registerFields(ctx, roomID, "", decodedMessage)
+
+	if len(statuses) > 0 {
+		messageText := strings.Join(statuses, "\n")
+		if _, err := postChatworkMessage(ctx, roomID, messageText); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "メッセージの送信に失敗しました",
+			})
+		}
+	}
+
+	return c.String(http.StatusOK, "OK")
+}
+
+// registerFields はメッセージに含まれる分野を登録し、分野ごとの結果の文言を返す
+// accountIDを指定した場合は、そのメンバーだけの分野として登録する
+func (uc *UserController) registerFields(ctx context.Context, roomID, accountID, message string) []string {
 	// メッセージ本文からワードを抽出
-	words := strings.FieldsFunc(decodedMessage, func(r rune) bool {
+	words := strings.FieldsFunc(message, func(r rune) bool {
 		return r == ',' || r == '、' || r == '\n'
 	})
 	fmt.Printf("抽出されたワード: %v\n", words)
 
-	// 各ワードに対して処理
-	var registeredWords []string
-	var alreadyRegisteredWords []string
-	var noArticleWords []string
+	// ルームに登録できる分野数の上限
+	room, err := fetchRoom(ctx, roomID)
+	if err != nil {
+		log.Printf("ルーム %s の取得に失敗しました: %v", roomID, err)
+	}
+	limit := fieldLimit(room)
+	limitReached := false
+
+	// 登録済みの分野の数は最初に1回だけ取得し、登録するたびに数え直す
+	// 上限に達したルームでは、Qiitaでの確認（APIの残りリクエスト数を使う）をせずに断る
+	count, err := countFields(ctx, roomID)
+	if err != nil {
+		log.Printf("ルーム %s の分野の数の取得に失敗しました: %v", roomID, err)
+		return []string{"登録済みの分野の数を確認できませんでした。時間をおいて再度お試しください"}
+	}
+
+	// 各ワードに対して処理し、ワードごとの結果を通知する
+	var statuses []string
 	for _, word := range words {
 		// 全角スペースを半角に変換し、複数のスペースを1つに統一
 		word = strings.Join(strings.Fields(strings.ReplaceAll(word, "　", " ")), " ")
@@ -102,6 +151,14 @@ func (uc *UserController) Register(c echo.Context) error {
 			continue
 		}
 		fmt.Printf("処理前のワード: %s\n", word)
+		input := word
+
+		// 上限に達している場合は登録せず、その旨を伝える
+		if count >= limit {
+			statuses = append(statuses, fmt.Sprintf("・%s: 分野の上限（%d件）に達しているため登録できませんでした", input, limit))
+			limitReached = true
+			continue
+		}
 
 		// 単語の正規化処理
 		// 1. 全角英数字を半角に変換
@@ -118,101 +175,19 @@ func (uc *UserController) Register(c echo.Context) error {
 			}
 		}, word)
 
-		// 2. 最初の文字を大文字に、それ以外を小文字に（英数字の場合のみ）
-		if len(word) > 0 {
-			firstChar := word[0]
-			if (firstChar >= 'A' && firstChar <= 'Z') || (firstChar >= 'a' && firstChar <= 'z') {
-				word = strings.ToUpper(string(word[0])) + strings.ToLower(word[1:])
-			}
+		// 2. "user:xxx"・"@xxx"・"org:xxx" はユーザー・organizationのフォロー、それ以外は式として扱う
+		var label, status string
+		var ok bool
+		kind, id, isFollow := parseFollow(word)
+		if isFollow {
+			word, label, status, ok = prepareFollowField(ctx, kind, id)
+		} else {
+			kind = fieldKindKeyword
+			word, label, status, ok = prepareKeywordField(ctx, input, word)
 		}
-
 		fmt.Printf("変換後: %s\n", word)
-
-		// スペースで分割
-		subWords := strings.Fields(word)
-		if len(subWords) == 0 {
-			continue
-		}
-
-		// 検索クエリを構築
-		var queryParts []string
-		for _, subWord := range subWords {
-			// 日本語のワードをURLエンコード
-			encodedWord := url.QueryEscape(subWord)
-			fmt.Printf("エンコード前のワード: %s\n", subWord)
-			fmt.Printf("エンコード後のワード: %s\n", encodedWord)
-			queryParts = append(queryParts, fmt.Sprintf("title:%s", encodedWord))
-		}
-		query := strings.Join(queryParts, "+") + "+stocks:>30"
-		fmt.Printf("Qiita検索クエリ: %s\n", query)
-
-		// QiitaのAPIで検索
-		qiitaReq, err := http.NewRequest("GET",
-			fmt.Sprintf("https://qiita.com/api/v2/items?query=%s&per_page=1", query),
-			nil)
-		if err != nil {
-			continue
-		}
-
-		// Qiitaのアクセストークンを設定
-		qiitaToken := os.Getenv("QIITA_ACCESS_TOKEN")
-		if qiitaToken == "" {
-			continue
-		}
-		qiitaReq.Header.Set("Authorization", "Bearer "+qiitaToken)
-
-		qiitaResp, err := client.Do(qiitaReq)
-		if err != nil {
-			continue
-		}
-		defer qiitaResp.Body.Close()
-
-		// レスポンスの内容を確認
-		qiitaBody, err := io.ReadAll(qiitaResp.Body)
-		if err != nil {
-			continue
-		}
-
-		var qiitaItems []map[string]interface{}
-		if err := json.Unmarshal(qiitaBody, &qiitaItems); err != nil {
-			continue
-		}
-
-		if len(qiitaItems) == 0 {
-			noArticleWords = append(noArticleWords, word)
-			continue
-		}
-
-		// 現在のroom_idのfield数を取得
-		fieldCountReq, err := http.NewRequest("GET",
-			fmt.Sprintf("%s/rest/v1/field?room_id=eq.%s&select=count", supabaseURL, roomID),
-			nil)
-		if err != nil {
-			continue
-		}
-
-		fieldCountReq.Header.Set("apikey", supabaseKey)
-		fieldCountReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-		fieldCountReq.Header.Set("Content-Type", "application/json")
-
-		fieldCountResp, err := client.Do(fieldCountReq)
-		if err != nil {
-			continue
-		}
-		defer fieldCountResp.Body.Close()
-
-		var fieldCount []map[string]interface{}
-		if err := json.NewDecoder(fieldCountResp.Body).Decode(&fieldCount); err != nil {
-			continue
-		}
-
-		count, ok := fieldCount[0]["count"].(float64)
 		if !ok {
-			continue
-		}
-
-		// 20件以上の場合、登録をスキップ
-		if count >= 20 {
+			statuses = append(statuses, fmt.Sprintf("・%s: %s", label, status))
 			continue
 		}
 
@@ -222,6 +197,12 @@ func (uc *UserController) Register(c echo.Context) error {
 			"field_name": word,
 			"priority":   3, // デフォルトの興味の強さを3（普通）に設定
 		}
+		if accountID != "" {
+			fieldData["account_id"] = accountID
+		}
+		if kind != fieldKindKeyword {
+			fieldData["kind"] = kind
+		}
 		fieldJSON, err := json.Marshal(fieldData)
 		if err != nil {
 			fmt.Printf("JSONマーシャリングエラー: %v\n", err)
@@ -230,18 +211,14 @@ func (uc *UserController) Register(c echo.Context) error {
 
 		fmt.Printf("Supabaseに保存するデータ: %s\n", string(fieldJSON))
 
-		fieldReq, err := http.NewRequest("POST", supabaseURL+"/rest/v1/field", bytes.NewBuffer(fieldJSON))
+		fieldReq, err := newSupabaseRequest(ctx, "POST", "field", bytes.NewBuffer(fieldJSON))
 		if err != nil {
 			fmt.Printf("Supabaseリクエスト作成エラー: %v\n", err)
 			continue
 		}
-
-		fieldReq.Header.Set("apikey", supabaseKey)
-		fieldReq.Header.Set("Authorization", "Bearer "+supabaseKey)
-		fieldReq.Header.Set("Content-Type", "application/json")
 		fieldReq.Header.Set("Prefer", "return=minimal")
 
-		fieldResp, err := client.Do(fieldReq)
+		fieldResp, err := supabaseClient.Do(fieldReq)
 		if err != nil {
 			fmt.Printf("Supabaseリクエスト送信エラー: %v\n", err)
 			continue
@@ -256,49 +233,70 @@ func (uc *UserController) Register(c echo.Context) error {
 
 			// 既に登録されている場合のメッセージを送信
 			if fieldResp.StatusCode == http.StatusConflict {
-				alreadyRegisteredWords = append(alreadyRegisteredWords, word)
+				statuses = append(statuses, fmt.Sprintf("・%s: 既に登録されています", label))
 			}
 			continue
 		}
 
 		// 登録成功したワードを記録
-		registeredWords = append(registeredWords, word)
+		count++
+		statuses = append(statuses, fmt.Sprintf("・%s: 登録しました（%s）", label, status))
 		fmt.Printf("登録成功: %s\n", word)
 	}
 
-	// 登録結果をまとめて通知
-	var messages []string
-	if len(registeredWords) > 0 {
-		messages = append(messages, fmt.Sprintf("・%s を登録しました", strings.Join(registeredWords, "、")))
+	if limitReached {
+		statuses = append(statuses, "登録済みの分野は /fields で確認できます。/remove 分野名 や /prune で不要な分野を削除してから、もう一度送ってください")
 	}
-	if len(alreadyRegisteredWords) > 0 {
-		messages = append(messages, fmt.Sprintf("・%s は既に登録されています", strings.Join(alreadyRegisteredWords, "、")))
+	return statuses
+}
+
+// countFields はルームに登録されている分野の数を返す
+func countFields(ctx context.Context, roomID string) (int, error) {
+	var rows []struct {
+		Count int `json:"count"`
 	}
-	if len(noArticleWords) > 0 {
-		messages = append(messages, fmt.Sprintf("・%s の人気の記事が見つからず、登録できませんでした", strings.Join(noArticleWords, "、")))
+	if err := getRows(ctx, "field?select=count&room_id=eq."+url.QueryEscape(roomID), &rows); err != nil {
+		return 0, err
 	}
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("分野の数を取得できませんでした")
+	}
+	return rows[0].Count, nil
+}
 
-	if len(messages) > 0 {
-		messageText := strings.Join(messages, "\n")
-		chatworkReq, err := http.NewRequest("POST",
-			fmt.Sprintf("https://api.chatwork.com/v2/rooms/%s/messages", roomID),
-			strings.NewReader(fmt.Sprintf("body=%s", messageText)))
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": "メッセージ送信リクエストの作成に失敗しました",
-			})
+// prepareKeywordField はタグ・タイトルの語を式として解析し、保存する分野名・表示用の名前・状態の文言を返す
+func prepareKeywordField(ctx context.Context, input, word string) (string, string, string, bool) {
+	// OR・除外（-）・フレーズ（"..."）を含む式として解析
+	expr, err := models.ParseFieldExpr(word)
+	if err != nil {
+		return word, input, fmt.Sprintf("式を解釈できませんでした（%v）", err), false
+	}
+
+	// 最初の文字を大文字に、それ以外を小文字に（英数字の場合のみ）
+	expr.MapTerms(func(term string) string {
+		firstChar := term[0]
+		if (firstChar >= 'A' && firstChar <= 'Z') || (firstChar >= 'a' && firstChar <= 'z') {
+			return strings.ToUpper(string(term[0])) + strings.ToLower(term[1:])
 		}
+		return term
+	})
 
-		chatworkReq.Header.Set("X-ChatWorkToken", chatworkToken)
-		chatworkReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// 表記ゆれを正式なQiitaタグ名に統一（golang → Go など）
+	qiitaTags.resolveExpr(ctx, expr)
 
-		_, err = client.Do(chatworkReq)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": "メッセージの送信に失敗しました",
-			})
-		}
-	}
+	// Qiitaのタグとして存在するか確認（フレーズ以外のすべての語）
+	status, ok := validateFieldExpr(ctx, expr)
+	word = expr.String()
 
-	return c.String(http.StatusOK, "OK")
+	label := word
+	if alias := describeAlias(input, word); alias != "" {
+		label = alias
+	}
+	if !ok {
+		return word, label, status, false
+	}
+	if status != "" {
+		status = "、" + status
+	}
+	return word, label, expr.Describe() + status, true
 }
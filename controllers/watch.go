@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"qiita-search/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ウォッチしている分野で人気が出始めた記事として配信した場合の探し方
+const strategyWatch = "watch"
+
+// watchMinStocks はウォッチしている分野で、記事をすぐに配信するストック数を返す
+// 分野ごとの watch_min_stocks が未設定の場合は WATCH_MIN_STOCKS（既定は5）
+func (f fieldInfo) watchMinStocks() int {
+	if f.WatchMinStocks > 0 {
+		return f.WatchMinStocks
+	}
+	return max(envInt("WATCH_MIN_STOCKS", 5), 1)
+}
+
+// watchQuery はウォッチしている分野で、最近投稿されてストック数がしきい値に達した記事を探すクエリを返す
+// 対象にする投稿日の範囲は WATCH_WINDOW（既定は48時間）で変更できる
+func (ac *ArticleController) watchQuery(ctx context.Context, field fieldInfo) string {
+	since := time.Now().Add(-envDuration("WATCH_WINDOW", 48*time.Hour)).In(jst).Format("2006-01-02")
+	return parseStoredField(ctx, field.Name).Query("tag", fmt.Sprintf("created:>=%s stocks:>=%d", since, field.watchMinStocks()))
+}
+
+// deliverWatchedArticles はウォッチを始めた後に投稿され、しきい値に達した記事のうち、まだ配信していない記事を配信する
+// 配信した記事は履歴に記録するため、毎日の配信で同じ記事が届くことはない
+func (ac *ArticleController) deliverWatchedArticles(ctx context.Context, field fieldInfo, articles []models.Article, summaries map[string]string) (deliveryResult, error) {
+	result := deliveryResult{RoomID: field.RoomID, Kind: strategyWatch}
+
+	blocks, err := fetchBlocks(ctx, "room_id=eq."+url.QueryEscape(field.RoomID))
+	if err != nil {
+		log.Printf("ルーム %s のブロックの取得に失敗しました: %v", field.RoomID, err)
+	}
+
+	var candidates []models.Article
+	for _, article := range articles {
+		if blocks[field.RoomID].blocks(article) {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, article.CreatedAt)
+		if err != nil || field.WatchedAt == nil || createdAt.Before(*field.WatchedAt) {
+			continue
+		}
+		if article.Stocks < field.watchMinStocks() {
+			continue
+		}
+		candidates = append(candidates, article)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt < candidates[j].CreatedAt
+	})
+
+	for _, article := range candidates {
+		delivered, err := isDelivered(ctx, field.RoomID, article.URL)
+		if err != nil {
+			return result, withOutcome(outcomeUpstreamError, err)
+		}
+		if delivered {
+			continue
+		}
+
+		// 人気が出始めたことをすぐに届けることを優先し、要約できなくても記事は配信する
+		summary, ok := summaries[article.URL]
+		if !ok {
+			if err := article.Summarize(ctx); err != nil {
+				log.Printf("記事 %s の要約に失敗しました: %v", article.URL, err)
+				result.SummaryFailures++
+			}
+			summary = article.Summary
+			summaries[article.URL] = summary
+		}
+		article.Summary = summary
+
+		p := pickedArticle{article: article, field: field.Name, strategy: strategyWatch, accountID: field.AccountID}
+		if err := postSingleArticle(ctx, field.RoomID, p); err != nil {
+			return result, withOutcome(outcomePostError, err)
+		}
+		result.Articles = append(result.Articles, deliveredArticle{URL: article.URL, Field: field.Name, Strategy: strategyWatch})
+		if err := recordHistory(ctx, field.RoomID, article.URL); err != nil {
+			return result, withOutcome(outcomeUpstreamError, err)
+		}
+	}
+
+	if len(result.Articles) == 0 {
+		return result, errNoNewArticle
+	}
+	return result, nil
+}
+
+func (uc *UserController) watchFieldCommand(ctx context.Context, roomID, accountID, args string) string {
+	// 最後の語が数字の場合は、すぐに配信するストック数として扱う
+	name := args
+	threshold := 0
+	if i := strings.LastIndex(args, " "); i >= 0 {
+		if n, err := strconv.Atoi(args[i+1:]); err == nil {
+			if n <= 0 {
+				return "ストック数は1以上を指定してください"
+			}
+			name, threshold = strings.TrimSpace(args[:i]), n
+		}
+	}
+
+	field, reply := lookupFieldForCommand(ctx, roomID, accountID, name)
+	if field == nil {
+		return reply
+	}
+	if field.isFollow() {
+		return fmt.Sprintf("・%s は新着記事をすべてお届けしているため、ウォッチする必要はありません", field.Name)
+	}
+
+	values := map[string]interface{}{}
+	if field.WatchedAt == nil {
+		values["watched_at"] = time.Now().UTC()
+	}
+	if threshold > 0 {
+		values["watch_min_stocks"] = threshold
+		field.WatchMinStocks = threshold
+	}
+	if len(values) == 0 {
+		return fmt.Sprintf("・%s はすでにウォッチしています（ストック %d 以上ですぐにお届け）", field.Name, field.watchMinStocks())
+	}
+	if err := updateField(ctx, *field, values); err != nil {
+		log.Printf("分野 %s の更新に失敗しました: %v", field.Name, err)
+		return fmt.Sprintf("・%s の更新に失敗しました。時間をおいて再度お試しください", field.Name)
+	}
+	return fmt.Sprintf("・%s をウォッチします。これから投稿される記事のストックが %d 以上になったら、すぐにお届けします", field.Name, field.watchMinStocks())
+}
+
+func (uc *UserController) unwatchFieldCommand(ctx context.Context, roomID, accountID, name string) string {
+	field, reply := lookupFieldForCommand(ctx, roomID, accountID, name)
+	if field == nil {
+		return reply
+	}
+	if field.WatchedAt == nil {
+		return fmt.Sprintf("・%s はウォッチしていません", field.Name)
+	}
+	if err := updateField(ctx, *field, map[string]interface{}{"watched_at": nil}); err != nil {
+		log.Printf("分野 %s の更新に失敗しました: %v", field.Name, err)
+		return fmt.Sprintf("・%s の更新に失敗しました。時間をおいて再度お試しください", field.Name)
+	}
+	return fmt.Sprintf("・%s のウォッチをやめました", field.Name)
+}
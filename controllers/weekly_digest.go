@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"qiita-search/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 配信の頻度（userテーブルの cadence）
+const (
+	cadenceDaily  = "daily"  // 毎日の記事だけ（未設定の場合）
+	cadenceWeekly = "weekly" // 週に1回のまとめだけ
+	cadenceBoth   = "both"   // 毎日の記事と週に1回のまとめの両方
+)
+
+// cadence はルームの配信の頻度を返す。解釈できない値は毎日として扱う
+func (r roomSettings) cadence() string {
+	switch c := strings.ToLower(strings.TrimSpace(r.Cadence)); c {
+	case cadenceDaily, cadenceWeekly, cadenceBoth:
+		return c
+	case "":
+		return cadenceDaily
+	default:
+		log.Printf("ルーム %s の配信頻度 %q が不正なため、毎日として扱います", r.RoomID, r.Cadence)
+		return cadenceDaily
+	}
+}
+
+// wantsDaily は毎日の記事を配信するルームかどうかを返す
+func (r roomSettings) wantsDaily() bool {
+	return r.cadence() != cadenceWeekly
+}
+
+// weeklyDue は今回の配信で週のまとめを送るルームかどうかを返す
+// 送る曜日が祝日や一時停止で配信されなかった場合は、その週のうちの次の配信で送る
+func (r roomSettings) weeklyDue(now time.Time, weekday time.Weekday) bool {
+	if r.cadence() == cadenceDaily {
+		return false
+	}
+	today := now.In(jst)
+	if r.WeeklySentAt == nil {
+		return today.Weekday() == weekday
+	}
+	// 直近の送る曜日（今日を含む）の0時より前に送ったのが最後なら、まだ今週分を送っていない
+	daysSince := (int(today.Weekday()) - int(weekday) + 7) % 7
+	y, m, d := today.AddDate(0, 0, -daysSince).Date()
+	return r.WeeklySentAt.Before(time.Date(y, m, d, 0, 0, 0, 0, jst))
+}
+
+// parseWeekday は WEEKLY_DIGEST_WEEKDAY（"monday"、"mon"、"1" など）を解析する。未設定や不正な値の場合は月曜日
+func parseWeekday(value string) time.Weekday {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return time.Monday
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if value == name || value == name[:3] || value == fmt.Sprint(int(d)) {
+			return d
+		}
+	}
+	log.Printf("WEEKLY_DIGEST_WEEKDAY %q が不正なため、月曜日に送ります", value)
+	return time.Monday
+}
+
+// deliverWeeklyRoundup はルームのすべての分野から、直近7日間に投稿されたストック数の多い記事を集め、
+// 順位を付けて1つのメッセージで投稿する
+func (ac *ArticleController) deliverWeeklyRoundup(ctx context.Context, room roomSettings, fieldInfos []fieldInfo) (deliveryResult, error) {
+	roomID := room.RoomID
+	result := deliveryResult{RoomID: roomID, Kind: cadenceWeekly}
+
+	since := time.Now().In(jst).AddDate(0, 0, -7).Format("2006-01-02")
+	prefix := fmt.Sprintf("created:>=%s stocks:>=%d", since, ac.weeklyMinStocks)
+
+	type candidate struct {
+		article models.Article
+		field   string
+	}
+	candidates := make(map[string]candidate)
+	var lastErr error
+	search := func(query, field string) error {
+		for page := 1; page <= ac.weeklyPages; page++ {
+			articles, err := ac.searchArticles(ctx, qiitaSearchURL(page, query))
+			if errors.Is(err, errQiitaRateLimited) {
+				return err
+			}
+			if err != nil {
+				log.Printf("週のまとめの検索に失敗しました（%d ページ目）: %v", page, err)
+				lastErr = err
+				return nil
+			}
+			for _, article := range articles {
+				if room.blocks.blocks(article) {
+					continue
+				}
+				if _, ok := candidates[article.URL]; !ok {
+					candidates[article.URL] = candidate{article: article, field: field}
+				}
+			}
+			if len(articles) == 0 {
+				break
+			}
+		}
+		return nil
+	}
+
+	for _, field := range fieldInfos {
+		if err := search(parseStoredField(ctx, field.Name).Query("tag", prefix), field.Name); err != nil {
+			return result, err
+		}
+	}
+	if len(fieldInfos) == 0 {
+		// 分野が登録されていないルームには、Qiita全体の人気記事をまとめる
+		if err := search(prefix, ""); err != nil {
+			return result, err
+		}
+	}
+
+	ranked := make([]candidate, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, c)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].article.Stocks != ranked[j].article.Stocks {
+			return ranked[i].article.Stocks > ranked[j].article.Stocks
+		}
+		return ranked[i].article.URL < ranked[j].article.URL
+	})
+
+	// 毎日の配信ですでに送った記事は除いて、上位から選ぶ
+	var picked []pickedArticle
+	for _, c := range ranked {
+		if len(picked) >= ac.weeklySize {
+			break
+		}
+		delivered, err := isDelivered(ctx, roomID, c.article.URL)
+		if err != nil {
+			log.Printf("配信履歴の確認に失敗しました: %v", err)
+			lastErr = err
+			continue
+		}
+		if !delivered {
+			picked = append(picked, pickedArticle{article: c.article, field: c.field, strategy: cadenceWeekly})
+		}
+	}
+	if len(picked) == 0 {
+		if lastErr != nil {
+			return result, withOutcome(outcomeUpstreamError, lastErr)
+		}
+		return result, errNoNewArticle
+	}
+
+	var summarized []pickedArticle
+	var summarizeErr error
+	for _, p := range picked {
+		if err := p.article.Summarize(ctx); err != nil {
+			log.Printf("記事 %s の要約に失敗しました: %v", p.article.URL, err)
+			summarizeErr = err
+			result.SummaryFailures++
+			continue
+		}
+		p.article.Title = fmt.Sprintf("%s（ストック %d）", p.article.Title, p.article.Stocks)
+		summarized = append(summarized, p)
+	}
+	if len(summarized) == 0 {
+		return result, withOutcome(outcomeSummarizerError, summarizeErr)
+	}
+
+	if err := postDigest(ctx, roomID, fmt.Sprintf("今週の人気記事 TOP%d（%s〜）", len(summarized), since), summarized); err != nil {
+		return result, withOutcome(outcomePostError, err)
+	}
+
+	for _, p := range summarized {
+		result.Articles = append(result.Articles, deliveredArticle{
+			URL:      p.article.URL,
+			Field:    p.field,
+			Strategy: p.strategy,
+		})
+		if err := recordHistory(ctx, roomID, p.article.URL); err != nil {
+			return result, err
+		}
+	}
+
+	// 送信済みの記録に失敗しても配信自体は成功しているため、ログだけ残す
+	if err := updateRoom(ctx, roomID, map[string]interface{}{"weekly_sent_at": time.Now().UTC()}); err != nil {
+		log.Printf("ルーム %s の週のまとめの送信日時の記録に失敗しました: %v", roomID, err)
+	}
+	return result, nil
+}
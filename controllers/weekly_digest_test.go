@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeeklyDue(t *testing.T) {
+	at := func(value string) time.Time {
+		d, err := time.ParseInLocation("2006-01-02 15:04", value, jst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	sentAt := func(value string) *time.Time {
+		d := at(value)
+		return &d
+	}
+
+	// 2026-10-19 は月曜日
+	tests := []struct {
+		name string
+		room roomSettings
+		now  time.Time
+		want bool
+	}{
+		{"毎日のみのルーム", roomSettings{Cadence: cadenceDaily}, at("2026-10-19 09:00"), false},
+		{"未設定は毎日のみ", roomSettings{}, at("2026-10-19 09:00"), false},
+		{"初回で送る曜日", roomSettings{Cadence: cadenceWeekly}, at("2026-10-19 09:00"), true},
+		{"初回で送る曜日以外", roomSettings{Cadence: cadenceWeekly}, at("2026-10-20 09:00"), false},
+		{"今週分を送信済み", roomSettings{Cadence: cadenceBoth, WeeklySentAt: sentAt("2026-10-19 09:01")}, at("2026-10-19 18:00"), false},
+		{"先週送った", roomSettings{Cadence: cadenceBoth, WeeklySentAt: sentAt("2026-10-12 09:01")}, at("2026-10-19 09:00"), true},
+		{"送る曜日に送れず翌日", roomSettings{Cadence: cadenceWeekly, WeeklySentAt: sentAt("2026-10-12 09:01")}, at("2026-10-20 09:00"), true},
+		{"週の途中で送信済み", roomSettings{Cadence: cadenceWeekly, WeeklySentAt: sentAt("2026-10-20 09:01")}, at("2026-10-25 09:00"), false},
+		// UTCでは日曜日でも、JSTでは月曜日
+		{"JSTで曜日を判定", roomSettings{Cadence: cadenceWeekly}, time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.room.weeklyDue(tt.now, time.Monday); got != tt.want {
+				t.Errorf("weeklyDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	tests := map[string]time.Weekday{
+		"":          time.Monday,
+		"friday":    time.Friday,
+		" Sat ":     time.Saturday,
+		"0":         time.Sunday,
+		"3":         time.Wednesday,
+		"someday":   time.Monday,
+		"WEDNESDAY": time.Wednesday,
+	}
+	for value, want := range tests {
+		if got := parseWeekday(value); got != want {
+			t.Errorf("parseWeekday(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"qiita-search/controllers"
+	"qiita-search/views"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -42,6 +43,7 @@ func main() {
 	log.Printf("CHATWORK_TOKEN exists: %v", os.Getenv("CHATWORK_API_TOKEN") != "")
 
 	e := echo.New()
+	e.Renderer = views.NewRenderer()
 
 	// ミドルウェアの設定
 	e.Use(middleware.Logger())
@@ -50,12 +52,29 @@ func main() {
 	// コントローラーのインスタンスを作成
 	articleController := controllers.NewArticleController()
 	userController := controllers.NewUserController()
+	adminController := controllers.NewAdminController()
+	dashboardController := controllers.NewDashboardController(articleController, userController)
 
 	// ルーティングの設定
 	e.GET("/", articleController.Index)
 	e.GET("/register", userController.Register)
 	e.GET("/save", articleController.SaveArticle)
 	e.POST("/save", articleController.SaveArticle)
+	e.GET("/snapshot", articleController.Snapshot)
+	e.GET("/poll", articleController.Poll)
+	e.GET("/feedback", articleController.Feedback)
+	e.POST("/feedback", articleController.Feedback)
+	e.GET("/dashboard", dashboardController.Show)
+	e.POST("/dashboard", dashboardController.Update)
+	e.POST("/dashboard/tags", dashboardController.Tags)
+	e.GET("/dashboard/preview", dashboardController.Preview)
+	e.GET("/dashboard/members", dashboardController.Members)
+
+	// 管理API（ADMIN_API_TOKEN で認証する）
+	admin := e.Group("/admin", controllers.AdminAuth())
+	admin.GET("/rooms/:room_id/blocks", adminController.ListBlocks)
+	admin.POST("/rooms/:room_id/blocks", adminController.AddBlock)
+	admin.DELETE("/rooms/:room_id/blocks/:id", adminController.RemoveBlock)
 
 	e.GET("/keepalive", func(c echo.Context) error {
 		return c.String(http.StatusOK, "alive!")
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/option"
@@ -15,6 +16,7 @@ type Tag struct {
 }
 
 type Article struct {
+	ID        string `json:"id"`
 	Title     string `json:"title"`
 	URL       string `json:"url"`
 	CreatedAt string `json:"created_at"`
@@ -34,15 +36,34 @@ type PageData struct {
 	Message string
 	Items   []Article
 	Query   string
+	// ページの見出し（未設定の場合はTitle）と、フォームの送信先・ボタン
+	Heading string
+	Action  string
+	Choices []PageChoice
 }
 
-func (a *Article) Summarize() error {
+// PageChoice はページのフォームのボタン。Nameを指定した場合は、その名前で値を送信する
+type PageChoice struct {
+	Label string
+	Name  string
+	Value string
+}
+
+// Summarize はGeminiで記事本文を要約する
+// 応答待ちの上限は GEMINI_TIMEOUT（例: 30s）で変更できる
+func (a *Article) Summarize(ctx context.Context) error {
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		return fmt.Errorf("GEMINI_API_KEY is not set")
 	}
 
-	ctx := context.Background()
+	timeout := 30 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("GEMINI_TIMEOUT")); err == nil && d > 0 {
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
 		return fmt.Errorf("error creating client: %v", err)
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldTerm は分野の式に含まれる1つの語
+type FieldTerm struct {
+	Value   string
+	Phrase  bool // "cursor rules" のように引用符で囲まれたフレーズ
+	Negated bool // -Next.js のように除外する語
+}
+
+// FieldClause はAND条件でつながった語の並び
+type FieldClause struct {
+	Terms []FieldTerm
+}
+
+// FieldExpr は分野の式。OR条件でつながった FieldClause の並び
+//
+//	Go OR Rust      → tag:Go OR tag:Rust
+//	React -Next.js  → tag:React -tag:Next.js
+//	"cursor rules"  → title:"cursor rules"
+//	cursor rules    → tag:cursor tag:rules
+type FieldExpr struct {
+	Clauses []FieldClause
+}
+
+// ParseFieldExpr は分野の文字列を式として解析する
+func ParseFieldExpr(input string) (*FieldExpr, error) {
+	tokens, err := tokenizeFieldExpr(input)
+	if err != nil {
+		return nil, err
+	}
+
+	expr := &FieldExpr{}
+	var clause FieldClause
+	closeClause := func() error {
+		if len(clause.Terms) == 0 {
+			return fmt.Errorf("OR の前後に語がありません")
+		}
+		hasPositive := false
+		for _, term := range clause.Terms {
+			if !term.Negated {
+				hasPositive = true
+			}
+		}
+		if !hasPositive {
+			return fmt.Errorf("除外する語（-）だけでは検索できません")
+		}
+		expr.Clauses = append(expr.Clauses, clause)
+		clause = FieldClause{}
+		return nil
+	}
+
+	for _, token := range tokens {
+		if token.or {
+			if err := closeClause(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		clause.Terms = append(clause.Terms, token.term)
+	}
+	if err := closeClause(); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+type fieldToken struct {
+	term FieldTerm
+	or   bool
+}
+
+func tokenizeFieldExpr(input string) ([]fieldToken, error) {
+	var tokens []fieldToken
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if runes[i] == ' ' || runes[i] == '\t' {
+			i++
+			continue
+		}
+
+		negated := false
+		if runes[i] == '-' && i+1 < len(runes) && runes[i+1] != ' ' {
+			negated = true
+			i++
+		}
+
+		if runes[i] == '"' || runes[i] == '“' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' && runes[end] != '”' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("引用符（\"）が閉じられていません")
+			}
+			phrase := strings.Join(strings.Fields(string(runes[i+1:end])), " ")
+			if phrase == "" {
+				return nil, fmt.Errorf("空のフレーズがあります")
+			}
+			tokens = append(tokens, fieldToken{term: FieldTerm{Value: phrase, Phrase: true, Negated: negated}})
+			i = end + 1
+			continue
+		}
+
+		end := i
+		for end < len(runes) && runes[end] != ' ' && runes[end] != '\t' && runes[end] != '"' {
+			end++
+		}
+		word := string(runes[i:end])
+		i = end
+
+		if !negated && strings.EqualFold(word, "OR") {
+			tokens = append(tokens, fieldToken{or: true})
+			continue
+		}
+		tokens = append(tokens, fieldToken{term: FieldTerm{Value: word, Negated: negated}})
+	}
+	return tokens, nil
+}
+
+// MapTerms はフレーズ以外の語をfnで変換する
+func (e *FieldExpr) MapTerms(fn func(string) string) {
+	for i := range e.Clauses {
+		for j := range e.Clauses[i].Terms {
+			if !e.Clauses[i].Terms[j].Phrase {
+				e.Clauses[i].Terms[j].Value = fn(e.Clauses[i].Terms[j].Value)
+			}
+		}
+	}
+}
+
+// Words はフレーズ以外の語（タグとして扱う語）を返す
+func (e *FieldExpr) Words() []string {
+	var words []string
+	for _, clause := range e.Clauses {
+		for _, term := range clause.Terms {
+			if !term.Phrase {
+				words = append(words, term.Value)
+			}
+		}
+	}
+	return words
+}
+
+// String は式を保存用の文字列に戻す
+func (e *FieldExpr) String() string {
+	clauses := make([]string, len(e.Clauses))
+	for i, clause := range e.Clauses {
+		terms := make([]string, len(clause.Terms))
+		for j, term := range clause.Terms {
+			value := term.Value
+			if term.Phrase {
+				value = `"` + value + `"`
+			}
+			if term.Negated {
+				value = "-" + value
+			}
+			terms[j] = value
+		}
+		clauses[i] = strings.Join(terms, " ")
+	}
+	return strings.Join(clauses, " OR ")
+}
+
+// Query はQiitaの検索クエリに変換する。qualifierには "tag" や "title" などを指定する
+// フレーズはタグにならないため、qualifierが "tag" の場合はタイトルから探す
+// prefix（"stocks:>=30" などの条件）はOR条件のそれぞれに付ける。Qiitaの検索では
+// "stocks:>=30 tag:Go OR tag:Rust" の stocks:>=30 が最初の条件にしか掛からないため
+func (e *FieldExpr) Query(qualifier, prefix string) string {
+	clauses := make([]string, len(e.Clauses))
+	for i, clause := range e.Clauses {
+		terms := make([]string, len(clause.Terms))
+		for j, term := range clause.Terms {
+			value := term.Value
+			q := qualifier
+			if term.Phrase {
+				value = `"` + value + `"`
+				if q == "tag" {
+					q = "title"
+				}
+			}
+			if q != "" {
+				value = q + ":" + value
+			}
+			if term.Negated {
+				value = "-" + value
+			}
+			terms[j] = value
+		}
+		if prefix != "" {
+			terms = append([]string{prefix}, terms...)
+		}
+		clauses[i] = strings.Join(terms, " ")
+	}
+	return strings.Join(clauses, " OR ")
+}
+
+// Describe は式をどう解釈したかを利用者向けに説明する
+func (e *FieldExpr) Describe() string {
+	clauses := make([]string, len(e.Clauses))
+	for i, clause := range e.Clauses {
+		var tags, phrases, excluded []string
+		for _, term := range clause.Terms {
+			quoted := "「" + term.Value + "」"
+			switch {
+			case term.Negated:
+				excluded = append(excluded, quoted)
+			case term.Phrase:
+				phrases = append(phrases, quoted)
+			default:
+				tags = append(tags, quoted)
+			}
+		}
+
+		var parts []string
+		switch {
+		case len(tags) > 1:
+			parts = append(parts, "タグ"+strings.Join(tags, "")+"のすべて")
+		case len(tags) == 1:
+			parts = append(parts, "タグ"+tags[0])
+		}
+		if len(phrases) > 0 {
+			parts = append(parts, "タイトルに"+strings.Join(phrases, ""))
+		}
+		description := strings.Join(parts, "・") + "を含む"
+		if len(excluded) > 0 {
+			description += "（" + strings.Join(excluded, "") + "を除く）"
+		}
+		clauses[i] = description
+	}
+	return strings.Join(clauses, " または ") + "記事"
+}
@@ -0,0 +1,88 @@
+package models
+
+import "testing"
+
+func TestParseFieldExpr(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string // String() の結果
+		wantErr bool
+	}{
+		{input: "Go", want: "Go"},
+		{input: "Go OR Rust", want: "Go OR Rust"},
+		{input: "Go or  Rust", want: "Go OR Rust"},
+		{input: "React -Next.js", want: "React -Next.js"},
+		{input: `"cursor  rules"`, want: `"cursor rules"`},
+		{input: `“cursor rules” AI`, want: `"cursor rules" AI`},
+		{input: "cursor rules", want: "cursor rules"},
+		{input: "-OR Go", want: "-OR Go"},
+		{input: "", wantErr: true},
+		{input: "OR Go", wantErr: true},
+		{input: "Go OR", wantErr: true},
+		{input: "Go OR OR Rust", wantErr: true},
+		{input: "-Go", wantErr: true},
+		{input: "Go OR -Rust", wantErr: true},
+		{input: `"cursor rules`, wantErr: true},
+		{input: `""`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := ParseFieldExpr(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseFieldExpr(%q) = %q, want error", tt.input, expr.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFieldExpr(%q): %v", tt.input, err)
+			}
+			if got := expr.String(); got != tt.want {
+				t.Errorf("ParseFieldExpr(%q).String() = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldExprQuery(t *testing.T) {
+	tests := []struct {
+		input     string
+		qualifier string
+		prefix    string
+		want      string
+	}{
+		{"Go", "tag", "", "tag:Go"},
+		{"Go OR Rust", "tag", "", "tag:Go OR tag:Rust"},
+		{"Go OR Rust", "tag", "stocks:>=30", "stocks:>=30 tag:Go OR stocks:>=30 tag:Rust"},
+		{"React -Next.js", "tag", "stocks:>=30", "stocks:>=30 tag:React -tag:Next.js"},
+		{`"cursor rules"`, "tag", "", `title:"cursor rules"`},
+		{`"cursor rules" OR AI`, "tag", "created:>=2026-10-01", `created:>=2026-10-01 title:"cursor rules" OR created:>=2026-10-01 tag:AI`},
+		{"cursor rules", "title", "", "title:cursor title:rules"},
+		{`"cursor rules" -AI`, "body", "", `body:"cursor rules" -body:AI`},
+		{"Go", "", "", "Go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input+"/"+tt.qualifier, func(t *testing.T) {
+			expr, err := ParseFieldExpr(tt.input)
+			if err != nil {
+				t.Fatalf("ParseFieldExpr(%q): %v", tt.input, err)
+			}
+			if got := expr.Query(tt.qualifier, tt.prefix); got != tt.want {
+				t.Errorf("Query(%q, %q) = %q, want %q", tt.qualifier, tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldExprMapTerms(t *testing.T) {
+	expr, err := ParseFieldExpr(`golang OR "go言語" -js`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr.MapTerms(func(word string) string {
+		return map[string]string{"golang": "Go", "js": "JavaScript"}[word]
+	})
+	if got, want := expr.String(), `Go OR "go言語" -JavaScript`; got != want {
+		t.Errorf("MapTerms の結果 = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	_ "embed"
+	"strings"
+	"time"
+)
+
+// 日本の祝日（内閣府の「国民の祝日」をもとにした一覧）。年が変わる前に翌年分を追加する
+//
+//go:embed holidays_jp.csv
+var holidaysJP string
+
+// Holidays は日付（YYYY-MM-DD）ごとの休日の名前
+type Holidays map[string]string
+
+// JapaneseHolidays は同梱の日本の祝日に、extraの日付（YYYY-MM-DD、会社の休業日など）を加えた休日を返す
+func JapaneseHolidays(extra []string) Holidays {
+	holidays := make(Holidays)
+	for i, line := range strings.Split(holidaysJP, "\n") {
+		date, name, ok := strings.Cut(strings.TrimSpace(line), ",")
+		if i == 0 || !ok {
+			continue
+		}
+		holidays[date] = name
+	}
+	for _, date := range extra {
+		if date = strings.TrimSpace(date); date != "" {
+			holidays[date] = "休業日"
+		}
+	}
+	return holidays
+}
+
+// Lookup はtの日付（tのタイムゾーンでの日付）が休日であれば、その名前を返す
+func (h Holidays) Lookup(t time.Time) (string, bool) {
+	name, ok := h[t.Format("2006-01-02")]
+	return name, ok
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// QiitaTag はQiitaの /api/v2/tags が返すタグ情報
+type QiitaTag struct {
+	ID             string `json:"id"`
+	FollowersCount int    `json:"followers_count"`
+	ItemsCount     int    `json:"items_count"`
+}
+
+// QiitaUser は /api/v2/users/:id で取得できるユーザー情報のうち、利用する項目
+type QiitaUser struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	FollowersCount int    `json:"followers_count"`
+	ItemsCount     int    `json:"items_count"`
+}
+
+// よく使われる表記ゆれと正式なQiitaタグの対応（キーは小文字）
+var builtinTagAliases = map[string]string{
+	"golang":           "Go",
+	"go言語":             "Go",
+	"js":               "JavaScript",
+	"ts":               "TypeScript",
+	"py":               "Python",
+	"python3":          "Python",
+	"k8s":              "Kubernetes",
+	"rb":               "Ruby",
+	"ror":              "Rails",
+	"rubyonrails":      "Rails",
+	"ruby on rails":    "Rails",
+	"nextjs":           "Next.js",
+	"nuxtjs":           "Nuxt.js",
+	"nuxt":             "Nuxt.js",
+	"vue":              "Vue.js",
+	"vuejs":            "Vue.js",
+	"nodejs":           "Node.js",
+	"reactjs":          "React",
+	"react native":     "ReactNative",
+	"postgres":         "PostgreSQL",
+	"postgresql":       "PostgreSQL",
+	"tf":               "Terraform",
+	"gcp":              "GoogleCloud",
+	"google cloud":     "GoogleCloud",
+	"c#":               "C#",
+	"csharp":           "C#",
+	"cpp":              "C++",
+	"c++":              "C++",
+	"ml":               "機械学習",
+	"machine learning": "機械学習",
+	"gh actions":       "GitHubActions",
+	"github actions":   "GitHubActions",
+}
+
+// TagAliases は表記ゆれを正式なQiitaタグ名に変換する
+type TagAliases struct {
+	canonical map[string]string
+}
+
+// NewTagAliases は組み込みの別名テーブルとQiitaのタグ一覧から TagAliases を作成する
+// 同じキーがある場合は組み込みの別名を優先する（Qiitaには "golang" タグも存在するため）
+func NewTagAliases(tags []QiitaTag) *TagAliases {
+	canonical := make(map[string]string, len(tags)+len(builtinTagAliases))
+	for _, tag := range tags {
+		canonical[strings.ToLower(tag.ID)] = tag.ID
+	}
+	for alias, name := range builtinTagAliases {
+		canonical[alias] = name
+	}
+	return &TagAliases{canonical: canonical}
+}
+
+// Resolve は1語を正式なタグ名に変換する。該当がなければ元の語とfalseを返す
+func (a *TagAliases) Resolve(word string) (string, bool) {
+	if name, ok := a.canonical[strings.ToLower(word)]; ok {
+		return name, true
+	}
+	return word, false
+}
+
+// ResolveExpr は式に含まれるフレーズ以外の語を正式なタグ名に変換する
+// AND条件の語全体が別名に一致する場合（ruby on rails など）は1つのタグにまとめる
+func (a *TagAliases) ResolveExpr(e *FieldExpr) {
+	for i, clause := range e.Clauses {
+		if len(clause.Terms) > 1 {
+			words := make([]string, 0, len(clause.Terms))
+			for _, term := range clause.Terms {
+				if term.Phrase || term.Negated {
+					break
+				}
+				words = append(words, term.Value)
+			}
+			if len(words) == len(clause.Terms) {
+				if name, ok := a.Resolve(strings.Join(words, " ")); ok {
+					e.Clauses[i].Terms = []FieldTerm{{Value: name}}
+					continue
+				}
+			}
+		}
+		for j, term := range clause.Terms {
+			if !term.Phrase {
+				e.Clauses[i].Terms[j].Value, _ = a.Resolve(term.Value)
+			}
+		}
+	}
+}
+
+// SuggestTags はwordに似た名前のタグを、編集距離が近く記事数が多い順に最大limit件返す
+func SuggestTags(word string, tags []QiitaTag, limit int) []string {
+	target := strings.ToLower(word)
+	maxDistance := max(1, len([]rune(target))/3)
+
+	type candidate struct {
+		id       string
+		distance int
+		items    int
+	}
+	var candidates []candidate
+	seen := make(map[string]int) // 小文字のタグ名 → candidatesの位置
+	add := func(id string, distance, items int) {
+		key := strings.ToLower(id)
+		if key == target {
+			return
+		}
+		// 複数の別名から同じタグが見つかった場合は、近いほうの距離を使う
+		if i, ok := seen[key]; ok {
+			candidates[i].distance = min(candidates[i].distance, distance)
+			return
+		}
+		seen[key] = len(candidates)
+		candidates = append(candidates, candidate{id: id, distance: distance, items: items})
+	}
+
+	for _, tag := range tags {
+		key := strings.ToLower(tag.ID)
+		distance := levenshtein(target, key)
+		if distance <= maxDistance || strings.HasPrefix(key, target) {
+			add(tag.ID, distance, tag.ItemsCount)
+		}
+	}
+	// 別名に似ている場合は正式名を候補にする（距離は別名との距離）
+	for alias, name := range builtinTagAliases {
+		if distance := levenshtein(target, alias); distance <= maxDistance {
+			add(name, distance, 0)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].items > candidates[j].items
+	})
+
+	var suggestions []string
+	for _, c := range candidates {
+		if len(suggestions) >= limit {
+			break
+		}
+		suggestions = append(suggestions, c.id)
+	}
+	return suggestions
+}
+
+// levenshtein は2つの文字列の編集距離を返す
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagAliasesResolve(t *testing.T) {
+	aliases := NewTagAliases([]QiitaTag{{ID: "Go"}, {ID: "golang"}, {ID: "Rust"}, {ID: "Next.js"}})
+
+	tests := []struct {
+		word   string
+		want   string
+		wantOK bool
+	}{
+		{"golang", "Go", true}, // Qiitaに golang タグがあっても組み込みの別名を優先する
+		{"GOLANG", "Go", true},
+		{"rust", "Rust", true},
+		{"nextjs", "Next.js", true},
+		{"k8s", "Kubernetes", true},
+		{"Zig", "Zig", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			got, ok := aliases.Resolve(tt.word)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Resolve(%q) = %q, %v, want %q, %v", tt.word, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTagAliasesResolveExpr(t *testing.T) {
+	aliases := NewTagAliases([]QiitaTag{{ID: "Go"}, {ID: "React"}, {ID: "AWS"}})
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"golang", "Go"},
+		{"golang OR rust", "Go OR rust"},
+		{"react -nextjs", "React -Next.js"},
+		{"ruby on rails", "Rails"},
+		{"Ruby on Rails OR golang", "Rails OR Go"},
+		{"ruby -on rails", "ruby -on rails"},                 // 除外を含む場合はまとめない
+		{`"machine learning" aws`, `"machine learning" AWS`}, // フレーズは変換しない
+		{"aws lambda", "AWS lambda"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := ParseFieldExpr(tt.input)
+			if err != nil {
+				t.Fatalf("ParseFieldExpr(%q): %v", tt.input, err)
+			}
+			aliases.ResolveExpr(expr)
+			if got := expr.String(); got != tt.want {
+				t.Errorf("ResolveExpr(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestTags(t *testing.T) {
+	tags := []QiitaTag{
+		{ID: "JavaScript", ItemsCount: 100000},
+		{ID: "Java", ItemsCount: 50000},
+		{ID: "Rust", ItemsCount: 8000},
+		{ID: "Ruby", ItemsCount: 30000},
+		{ID: "Rails", ItemsCount: 20000},
+		{ID: "Docker", ItemsCount: 40000},
+		{ID: "docker-compose", ItemsCount: 9000},
+	}
+
+	tests := []struct {
+		name  string
+		word  string
+		limit int
+		want  []string
+	}{
+		{"編集距離の近い順", "Rusy", 5, []string{"Ruby", "Rust"}}, // 距離が同じなら記事数の多い順
+		{"前方一致も候補にする", "docker", 5, []string{"docker-compose"}},
+		{"同じ名前のタグは除く", "Java", 5, []string{"JavaScript"}},
+		{"件数の上限", "Rusy", 1, []string{"Ruby"}},
+		{"組み込みの別名の正式名", "golnag", 5, []string{"Go"}},
+		{"複数の別名から同じタグは1件", "nuxtj", 5, []string{"Nuxt.js"}},
+		{"似たタグがない", "Haskell", 5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SuggestTags(tt.word, tags, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SuggestTags(%q, %d) = %q, want %q", tt.word, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"go", "", 2},
+		{"rust", "rusty", 1},
+		{"kitten", "sitting", 3},
+		{"機械学習", "機械学", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+-- ルームごとの記事の探し方（例: 'tag:4,title:2,related,global'）
+-- 未設定の場合は tag:4,title:4,global:4 の順に探す
+alter table "user" add column if not exists search_strategy text;
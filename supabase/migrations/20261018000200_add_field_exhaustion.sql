@@ -0,0 +1,5 @@
+-- 分野ごとのストック数の条件（未設定の場合は30）
+alter table field add column if not exists min_stocks integer;
+-- 分野で記事が見つからなかった連続回数と、削除の確認を送った日時
+alter table field add column if not exists empty_strikes integer not null default 0;
+alter table field add column if not exists exhausted_at timestamptz;
@@ -0,0 +1,2 @@
+-- ルームごとに1回の配信で送る記事数（未設定の場合は1件）
+alter table "user" add column if not exists digest_size integer;
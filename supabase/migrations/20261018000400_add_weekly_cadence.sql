@@ -0,0 +1,4 @@
+-- ルームの配信頻度（daily / weekly / both、未設定の場合は daily）
+alter table "user" add column if not exists cadence text;
+-- 週のまとめを最後に送った日時（同じ週に重複して送らないため）
+alter table "user" add column if not exists weekly_sent_at timestamptz;
@@ -0,0 +1,11 @@
+-- 人気上昇中の記事を探すための、記事のストック数・いいね数の定期的な記録
+create table if not exists article_snapshot (
+  id bigint generated by default as identity primary key,
+  item_id text not null,
+  article_url text not null,
+  stocks_count integer not null default 0,
+  likes_count integer not null default 0,
+  observed_at timestamptz not null default now()
+);
+create index if not exists article_snapshot_item_id_observed_at_idx on article_snapshot (item_id, observed_at);
+create index if not exists article_snapshot_observed_at_idx on article_snapshot (observed_at);
@@ -0,0 +1,4 @@
+-- 分野の種類（keyword / user / org、未設定の場合は keyword）
+alter table field add column if not exists kind text;
+-- フォローする分野で確認済みの最新の記事の投稿日時
+alter table field add column if not exists last_seen_at timestamptz;
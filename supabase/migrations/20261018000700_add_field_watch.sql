@@ -0,0 +1,4 @@
+-- 分野のウォッチを始めた日時（未設定の場合はウォッチしていない）
+alter table field add column if not exists watched_at timestamptz;
+-- ウォッチしている分野で、記事をすぐに配信するストック数（未設定の場合は WATCH_MIN_STOCKS）
+alter table field add column if not exists watch_min_stocks integer;
@@ -0,0 +1,8 @@
+-- 分野・保存した記事の持ち主（ChatworkのアカウントID、未設定の場合はルーム全体）
+alter table field add column if not exists account_id text;
+alter table reserve_article add column if not exists account_id text;
+
+-- 同じ分野をルーム全体とメンバーごとに登録できるよう、一意制約にアカウントIDを含める
+alter table field drop constraint if exists field_room_id_field_name_key;
+create unique index if not exists field_room_id_field_name_account_id_key
+  on field (room_id, field_name, coalesce(account_id, ''));
@@ -0,0 +1,3 @@
+-- ダイレクトチャットとして登録したルームの持ち主（ChatworkのアカウントID、グループのルームの場合は未設定）
+alter table "user" add column if not exists account_id text;
+create unique index if not exists user_account_id_key on "user" (account_id) where account_id is not null;
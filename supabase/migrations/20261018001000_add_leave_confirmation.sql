@@ -0,0 +1,2 @@
+-- 配信の解除（/leave）の確認を送った日時
+alter table "user" add column if not exists leave_requested_at timestamptz;
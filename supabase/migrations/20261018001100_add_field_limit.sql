@@ -0,0 +1,3 @@
+-- ルームごとの分野数の上限（未設定の場合はプランの上限、または FIELD_LIMIT）と、プラン
+alter table "user" add column if not exists field_limit integer;
+alter table "user" add column if not exists plan text;
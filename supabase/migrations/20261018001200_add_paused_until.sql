@@ -0,0 +1,2 @@
+-- 配信を一時停止する期限（/pause で設定し、/resume で解除する）
+alter table "user" add column if not exists paused_until timestamptz;
@@ -0,0 +1,11 @@
+-- ルームで配信しないタグ・著者（配信したメッセージのフィードバックのリンクから追加する）
+create table if not exists room_block (
+  id bigint generated by default as identity primary key,
+  room_id text not null,
+  kind text not null,
+  value text not null,
+  created_at timestamptz not null default now()
+);
+
+create unique index if not exists room_block_room_kind_value_idx
+  on room_block (room_id, kind, lower(value));
@@ -0,0 +1,3 @@
+-- ブロックの種類（tag: タグ、author: 著者、keyword: タイトルに含まれる語）
+alter table room_block drop constraint if exists room_block_kind_check;
+alter table room_block add constraint room_block_kind_check check (kind in ('tag', 'author', 'keyword'));
@@ -0,0 +1,5 @@
+-- 管理ページで配信履歴を新しい順に表示するための配信日時
+-- 既存の行の配信日時は分からないため NULL のままにし、これから記録する行にだけ既定値（記録した日時）を入れる
+alter table article_history add column if not exists created_at timestamptz;
+alter table article_history alter column created_at set default now();
+create index if not exists article_history_room_id_created_at_idx on article_history (room_id, created_at desc);
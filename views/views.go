@@ -0,0 +1,55 @@
+package views
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+
+	"github.com/labstack/echo/v4"
+)
+
+// templates はページのテンプレート。layout.html を共通のレイアウトとして、
+// ほかのファイルはそれぞれ "content" を定義する
+//
+//go:embed templates/*.html
+var templates embed.FS
+
+// layoutFile はすべてのページで共通のレイアウト
+const layoutFile = "layout.html"
+
+// Renderer は埋め込んだテンプレートでページを表示する echo.Renderer
+// c.Render(status, "page.html", data) のように、ページのファイル名で呼び出す
+type Renderer struct {
+	pages map[string]*template.Template
+}
+
+// NewRenderer はテンプレートを読み込んで Renderer を作る
+func NewRenderer() *Renderer {
+	layout := template.Must(template.ParseFS(templates, "templates/"+layoutFile))
+
+	files, err := fs.Glob(templates, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	pages := make(map[string]*template.Template)
+	for _, file := range files {
+		name := file[len("templates/"):]
+		if name == layoutFile {
+			continue
+		}
+		// ページごとに "content" の定義が異なるため、レイアウトを複製してから読み込む
+		pages[name] = template.Must(template.Must(layout.Clone()).ParseFS(templates, file))
+	}
+	return &Renderer{pages: pages}
+}
+
+// Render はページをレイアウトに埋め込んで書き出す
+func (r *Renderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	page, ok := r.pages[name]
+	if !ok {
+		return fmt.Errorf("テンプレート %s が見つかりません", name)
+	}
+	return page.ExecuteTemplate(w, "layout", data)
+}